@@ -1,9 +1,15 @@
 package upyun
 
 import (
+	"crypto/subtle"
+	"errors"
 	"fmt"
+	"net/url"
+	"path"
 	"sort"
+	"strconv"
 	"strings"
+	"time"
 )
 
 type RESTAuthConfig struct {
@@ -26,46 +32,89 @@ type UnifiedAuthConfig struct {
 	ContentMD5 string
 }
 
+// The Make*Auth methods sign with the credentials of the provider of
+// UpYunConfig.Credentials if any, and return "" if it fails.
+
 func (u *UpYun) MakeRESTAuth(config *RESTAuthConfig) string {
+	keys, err := u.signingKeys()
+	if err != nil {
+		return ""
+	}
+	return makeRESTAuth(keys, config)
+}
+
+func makeRESTAuth(keys *signKeys, config *RESTAuthConfig) string {
 	sign := []string{
 		config.Method,
 		config.Uri,
 		config.DateStr,
 		config.LengthStr,
-		u.Password,
+		keys.password,
 	}
-	return "UpYun " + u.Operator + ":" + md5Str(strings.Join(sign, "&"))
+	return "UpYun " + keys.operator + ":" + md5Str(strings.Join(sign, "&"))
 }
 
 func (u *UpYun) MakePurgeAuth(config *PurgeAuthConfig) string {
+	keys, err := u.signingKeys()
+	if err != nil {
+		return ""
+	}
+	return makePurgeAuth(keys, u.Bucket, config)
+}
+
+func makePurgeAuth(keys *signKeys, bucket string, config *PurgeAuthConfig) string {
 	sign := []string{
 		config.PurgeList,
-		u.Bucket,
+		bucket,
 		config.DateStr,
-		u.Password,
+		keys.password,
 	}
-	return "UpYun " + u.Bucket + ":" + u.Operator + ":" + md5Str(strings.Join(sign, "&"))
+	return "UpYun " + bucket + ":" + keys.operator + ":" + md5Str(strings.Join(sign, "&"))
 }
 
 func (u *UpYun) MakeFormAuth(policy string) string {
-	return md5Str(base64ToStr([]byte(policy)) + "&" + u.Secret)
+	keys, err := u.signingKeys()
+	if err != nil {
+		return ""
+	}
+	return makeFormAuth(keys, policy)
+}
+
+func makeFormAuth(keys *signKeys, policy string) string {
+	return md5Str(base64ToStr([]byte(policy)) + "&" + keys.secret)
 }
 
 func (u *UpYun) MakeProcessAuth(kwargs map[string]string) string {
-	keys := []string{}
+	keys, err := u.signingKeys()
+	if err != nil {
+		return ""
+	}
+	return makeProcessAuth(keys, kwargs)
+}
+
+func makeProcessAuth(keys *signKeys, kwargs map[string]string) string {
+	names := []string{}
 	for k := range kwargs {
-		keys = append(keys, k)
+		names = append(names, k)
 	}
-	sort.Strings(keys)
+	sort.Strings(names)
 
 	auth := ""
-	for _, k := range keys {
+	for _, k := range names {
 		auth += k + kwargs[k]
 	}
-	return fmt.Sprintf("UpYun %s:%s", u.Operator, md5Str(u.Operator+auth+u.Password))
+	return fmt.Sprintf("UpYun %s:%s", keys.operator, md5Str(keys.operator+auth+keys.password))
 }
 
 func (u *UpYun) MakeUnifiedAuth(config *UnifiedAuthConfig) string {
+	keys, err := u.signingKeys()
+	if err != nil {
+		return ""
+	}
+	return makeUnifiedAuth(keys, config)
+}
+
+func makeUnifiedAuth(keys *signKeys, config *UnifiedAuthConfig) string {
 	sign := []string{
 		config.Method,
 		config.Uri,
@@ -79,6 +128,87 @@ func (u *UpYun) MakeUnifiedAuth(config *UnifiedAuthConfig) string {
 			signNoEmpty = append(signNoEmpty, v)
 		}
 	}
-	signStr := base64ToStr(hmacSha1(u.Password, []byte(strings.Join(signNoEmpty, "&"))))
-	return "UpYun " + u.Operator + ":" + signStr
+	signStr := base64ToStr(hmacSha1(keys.password, []byte(strings.Join(signNoEmpty, "&"))))
+	return "UpYun " + keys.operator + ":" + signStr
+}
+
+var (
+	ErrTokenInvalid = errors.New("invalid _upt token")
+	ErrTokenExpired = errors.New("expired _upt token")
+)
+
+// TokenURLConfig describes a URL of a domain with token anti-leech.
+type TokenURLConfig struct {
+	// Domain: "cdn.example.com" or with a scheme, https by default
+	Domain string
+	Path   string
+	// Secret: the token secret of the domain
+	Secret string
+	// ExpireAfter: the URL is valid this long, ignored if Expire is set
+	ExpireAfter time.Duration
+	Expire      time.Time
+	// Params: other query parameters, which the token does not cover
+	Params url.Values
+}
+
+// MakeTokenAuth returns the _upt token of uri, the escaped path of a URL,
+// valid until the unix time etime.
+func MakeTokenAuth(secret, uri string, etime int64) string {
+	e := strconv.FormatInt(etime, 10)
+	return md5Str(secret + "&" + e + "&" + uri)[12:20] + e
+}
+
+// MakeTokenURL returns the URL of config.Path signed with a _upt token.
+func MakeTokenURL(config *TokenURLConfig) (string, error) {
+	if config.Domain == "" || config.Secret == "" {
+		return "", errorOperation("make token url: needs Domain and Secret", nil)
+	}
+	expire := config.Expire
+	if expire.IsZero() {
+		if config.ExpireAfter <= 0 {
+			return "", errorOperation("make token url: needs Expire or ExpireAfter", nil)
+		}
+		expire = time.Now().Add(config.ExpireAfter)
+	}
+
+	base := strings.TrimSuffix(config.Domain, "/")
+	if !strings.Contains(base, "://") {
+		base = "https://" + base
+	}
+	uri := escapeUri(path.Join("/", config.Path))
+
+	query := url.Values{}
+	for k, v := range config.Params {
+		if k != "_upt" {
+			query[k] = v
+		}
+	}
+	query.Set("_upt", MakeTokenAuth(config.Secret, uri, expire.Unix()))
+	return base + uri + "?" + query.Encode(), nil
+}
+
+// VerifyTokenAuth checks the _upt token of uri at time now, it returns
+// ErrTokenInvalid or ErrTokenExpired.
+func VerifyTokenAuth(secret, uri, upt string, now time.Time) error {
+	if len(upt) <= 8 {
+		return ErrTokenInvalid
+	}
+	etime, err := strconv.ParseInt(upt[8:], 10, 64)
+	if err != nil {
+		return ErrTokenInvalid
+	}
+	expect := MakeTokenAuth(secret, uri, etime)
+	if subtle.ConstantTimeCompare([]byte(expect), []byte(upt)) != 1 {
+		return ErrTokenInvalid
+	}
+	if now.Unix() > etime {
+		return ErrTokenExpired
+	}
+	return nil
+}
+
+// VerifyTokenURL checks the _upt parameter of a URL made by MakeTokenURL, or
+// of the URL of an incoming request.
+func VerifyTokenURL(secret string, u *url.URL, now time.Time) error {
+	return VerifyTokenAuth(secret, u.EscapedPath(), u.Query().Get("_upt"), now)
 }
@@ -0,0 +1,42 @@
+package upyun
+
+import (
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestTokenURL(t *testing.T) {
+	expire := time.Unix(1700000000, 0)
+	Equal(t, MakeTokenAuth("secret", "/a%20b/c.jpg", expire.Unix()), "1716ee011700000000")
+
+	s, err := MakeTokenURL(&TokenURLConfig{
+		Domain: "cdn.example.com",
+		Path:   "a b/c.jpg",
+		Secret: "secret",
+		Expire: expire,
+		Params: url.Values{"w": {"100"}},
+	})
+	Nil(t, err)
+	Equal(t, s, "https://cdn.example.com/a%20b/c.jpg?_upt=1716ee011700000000&w=100")
+
+	u, err := url.Parse(s)
+	Nil(t, err)
+	Nil(t, VerifyTokenURL("secret", u, expire))
+	Equal(t, VerifyTokenURL("secret", u, expire.Add(time.Second)), ErrTokenExpired)
+	Equal(t, VerifyTokenURL("other", u, expire), ErrTokenInvalid)
+
+	u.Path = "/a b/d.jpg"
+	u.RawPath = ""
+	Equal(t, VerifyTokenURL("secret", u, expire), ErrTokenInvalid)
+	Equal(t, VerifyTokenAuth("secret", "/a%20b/c.jpg", "1716ee011700000001", expire), ErrTokenInvalid)
+	Equal(t, VerifyTokenAuth("secret", "/a%20b/c.jpg", "", expire), ErrTokenInvalid)
+
+	_, err = MakeTokenURL(&TokenURLConfig{Domain: "cdn.example.com", Path: "/a", Secret: "secret"})
+	NotNil(t, err)
+	s, err = MakeTokenURL(&TokenURLConfig{Domain: "http://cdn.example.com/", Path: "/a", Secret: "secret", ExpireAfter: time.Minute})
+	Nil(t, err)
+	u, _ = url.Parse(s)
+	Equal(t, u.Scheme, "http")
+	Nil(t, VerifyTokenURL("secret", u, time.Now()))
+}
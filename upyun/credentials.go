@@ -0,0 +1,201 @@
+package upyun
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Credentials are the operator, its password in clear and the form API
+// secret of deprecated auth.
+type Credentials struct {
+	Operator string `json:"operator"`
+	Password string `json:"password"`
+	Secret   string `json:"secret"`
+}
+
+// CredentialsProvider returns the credentials to sign with. It is called
+// for every signature, so that rotated credentials are used without a
+// restart, and by concurrent requests.
+type CredentialsProvider interface {
+	Credentials() (*Credentials, error)
+}
+
+// StaticCredentials is a CredentialsProvider of fixed credentials.
+type StaticCredentials Credentials
+
+func (c *StaticCredentials) Credentials() (*Credentials, error) {
+	creds := Credentials(*c)
+	return &creds, nil
+}
+
+// EnvCredentials reads the credentials from the environment variables
+// <Prefix>OPERATOR, <Prefix>PASSWORD and <Prefix>SECRET, Prefix defaults to
+// "UPYUN_".
+type EnvCredentials struct {
+	Prefix string
+}
+
+func (e *EnvCredentials) Credentials() (*Credentials, error) {
+	prefix := e.Prefix
+	if prefix == "" {
+		prefix = "UPYUN_"
+	}
+	creds := &Credentials{
+		Operator: os.Getenv(prefix + "OPERATOR"),
+		Password: os.Getenv(prefix + "PASSWORD"),
+		Secret:   os.Getenv(prefix + "SECRET"),
+	}
+	if creds.Operator == "" || creds.Password == "" {
+		return nil, errorOperation("env credentials: "+prefix+"OPERATOR or "+prefix+"PASSWORD not set", nil)
+	}
+	return creds, nil
+}
+
+// FileCredentials reads the credentials from a JSON file, of the fields of
+// Credentials, or from an INI file of operator, password and secret keys.
+// The file is read again whenever its size or modification time changes.
+type FileCredentials struct {
+	path string
+	// Section: the INI section of the credentials, keys outside any
+	// section by default
+	Section string
+
+	mu      sync.Mutex
+	size    int64
+	modTime time.Time
+	creds   *Credentials
+}
+
+func NewFileCredentials(path string) *FileCredentials {
+	return &FileCredentials{path: path}
+}
+
+func (f *FileCredentials) Credentials() (*Credentials, error) {
+	info, err := os.Stat(f.path)
+	if err != nil {
+		return nil, errorOperation("file credentials", err)
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.creds != nil && info.Size() == f.size && info.ModTime().Equal(f.modTime) {
+		creds := *f.creds
+		return &creds, nil
+	}
+
+	b, err := os.ReadFile(f.path)
+	if err != nil {
+		return nil, errorOperation("file credentials", err)
+	}
+	creds := &Credentials{}
+	if strings.EqualFold(filepath.Ext(f.path), ".json") {
+		err = json.Unmarshal(b, creds)
+	} else {
+		err = parseINICredentials(b, f.Section, creds)
+	}
+	if err == nil && (creds.Operator == "" || creds.Password == "") {
+		err = errors.New("operator or password missing")
+	}
+	if err != nil {
+		return nil, errorOperation("file credentials "+f.path, err)
+	}
+
+	f.creds, f.size, f.modTime = creds, info.Size(), info.ModTime()
+	c := *creds
+	return &c, nil
+}
+
+func parseINICredentials(b []byte, section string, creds *Credentials) error {
+	current := ""
+	scanner := bufio.NewScanner(bytes.NewReader(b))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || line[0] == '#' || line[0] == ';' {
+			continue
+		}
+		if line[0] == '[' && line[len(line)-1] == ']' {
+			current = strings.TrimSpace(line[1 : len(line)-1])
+			continue
+		}
+		if current != section {
+			continue
+		}
+		i := strings.IndexByte(line, '=')
+		if i < 0 {
+			return errors.New("invalid line: " + line)
+		}
+		value := strings.Trim(strings.TrimSpace(line[i+1:]), `"`)
+		switch strings.ToLower(strings.TrimSpace(line[:i])) {
+		case "operator":
+			creds.Operator = value
+		case "password":
+			creds.Password = value
+		case "secret":
+			creds.Secret = value
+		}
+	}
+	return scanner.Err()
+}
+
+// CachedCredentials keeps the credentials of Provider for TTL, so that a
+// slow provider is not called for every signature.
+type CachedCredentials struct {
+	Provider CredentialsProvider
+	TTL      time.Duration
+
+	mu      sync.Mutex
+	creds   *Credentials
+	expires time.Time
+}
+
+func NewCachedCredentials(provider CredentialsProvider, ttl time.Duration) *CachedCredentials {
+	return &CachedCredentials{Provider: provider, TTL: ttl}
+}
+
+func (c *CachedCredentials) Credentials() (*Credentials, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.creds == nil || !time.Now().Before(c.expires) {
+		creds, err := c.Provider.Credentials()
+		if err != nil {
+			return nil, err
+		}
+		c.creds, c.expires = creds, time.Now().Add(c.TTL)
+	}
+	creds := *c.creds
+	return &creds, nil
+}
+
+// Expire makes the next call ask the provider again.
+func (c *CachedCredentials) Expire() {
+	c.mu.Lock()
+	c.creds = nil
+	c.mu.Unlock()
+}
+
+// signKeys are the keys of a signature: the operator, the md5 of the
+// password and the secret.
+type signKeys struct {
+	operator, password, secret string
+}
+
+// signingKeys returns the keys to sign with. It is called once per
+// signature, so that all of it uses the same credentials, and the error of
+// the provider fails the signature.
+func (up *UpYun) signingKeys() (*signKeys, error) {
+	if up.Credentials == nil {
+		return &signKeys{up.Operator, up.Password, up.Secret}, nil
+	}
+	creds, err := up.Credentials.Credentials()
+	if err != nil {
+		return nil, errorOperation("credentials", err)
+	}
+	return &signKeys{creds.Operator, md5Str(creds.Password), creds.Secret}, nil
+}
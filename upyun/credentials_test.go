@@ -0,0 +1,117 @@
+package upyun
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+type countingCredentials struct {
+	calls int
+	err   error
+}
+
+func (c *countingCredentials) Credentials() (*Credentials, error) {
+	c.calls++
+	if c.err != nil {
+		return nil, c.err
+	}
+	return &Credentials{Operator: "operator", Password: "password"}, nil
+}
+
+func TestCredentialsProviders(t *testing.T) {
+	creds, err := (&StaticCredentials{Operator: "operator", Password: "password"}).Credentials()
+	Nil(t, err)
+	Equal(t, creds.Operator, "operator")
+
+	t.Setenv("TEST_UPYUN_OPERATOR", "env-operator")
+	t.Setenv("TEST_UPYUN_PASSWORD", "env-password")
+	creds, err = (&EnvCredentials{Prefix: "TEST_UPYUN_"}).Credentials()
+	Nil(t, err)
+	Equal(t, *creds, Credentials{Operator: "env-operator", Password: "env-password"})
+	_, err = (&EnvCredentials{Prefix: "TEST_MISSING_"}).Credentials()
+	NotNil(t, err)
+
+	dir := TempLocalDir(t)
+	defer os.RemoveAll(dir)
+	name := filepath.Join(dir, "credentials.json")
+	Nil(t, os.WriteFile(name, []byte(`{"operator":"a","password":"1"}`), 0600))
+	file := NewFileCredentials(name)
+	creds, err = file.Credentials()
+	Nil(t, err)
+	Equal(t, creds.Password, "1")
+	Nil(t, os.WriteFile(name, []byte(`{"operator":"a","password":"22"}`), 0600))
+	creds, err = file.Credentials()
+	Nil(t, err)
+	Equal(t, creds.Password, "22")
+
+	name = filepath.Join(dir, "credentials")
+	Nil(t, os.WriteFile(name, []byte("operator = a\npassword = 1\n\n[backup]\n; comment\noperator = b\npassword = \"2\"\nsecret = s\n"), 0600))
+	file = NewFileCredentials(name)
+	creds, err = file.Credentials()
+	Nil(t, err)
+	Equal(t, *creds, Credentials{Operator: "a", Password: "1"})
+	file = NewFileCredentials(name)
+	file.Section = "backup"
+	creds, err = file.Credentials()
+	Nil(t, err)
+	Equal(t, *creds, Credentials{Operator: "b", Password: "2", Secret: "s"})
+	_, err = NewFileCredentials(filepath.Join(dir, "missing")).Credentials()
+	NotNil(t, err)
+
+	provider := &countingCredentials{}
+	cached := NewCachedCredentials(provider, 50*time.Millisecond)
+	for i := 0; i < 3; i++ {
+		_, err = cached.Credentials()
+		Nil(t, err)
+	}
+	Equal(t, provider.calls, 1)
+	time.Sleep(60 * time.Millisecond)
+	_, err = cached.Credentials()
+	Nil(t, err)
+	Equal(t, provider.calls, 2)
+	cached.Expire()
+	provider.err = errors.New("unavailable")
+	_, err = cached.Credentials()
+	NotNil(t, err)
+}
+
+func TestCredentialsRotation(t *testing.T) {
+	static := &StaticCredentials{Operator: "operator", Password: "old"}
+	rotating := NewUpYun(&UpYunConfig{Bucket: "bucket", Credentials: static})
+	config := &UnifiedAuthConfig{Method: "GET", Uri: "/bucket/a", DateStr: makeRFC1123Date(time.Now())}
+
+	old := NewUpYun(&UpYunConfig{Bucket: "bucket", Operator: "operator", Password: "old"})
+	Equal(t, rotating.MakeUnifiedAuth(config), old.MakeUnifiedAuth(config))
+	static.Password = "new"
+	renewed := NewUpYun(&UpYunConfig{Bucket: "bucket", Operator: "operator", Password: "new"})
+	Equal(t, rotating.MakeUnifiedAuth(config), renewed.MakeUnifiedAuth(config))
+	Equal(t, rotating.MakeRESTAuth(&RESTAuthConfig{Method: "GET", Uri: "/bucket/a"}),
+		renewed.MakeRESTAuth(&RESTAuthConfig{Method: "GET", Uri: "/bucket/a"}))
+
+	// one provider call per signature
+	counting := &countingCredentials{}
+	up := NewUpYun(&UpYunConfig{Bucket: "bucket", Credentials: counting})
+	req, err := http.NewRequest("PUT", "https://v0.api.upyun.com/bucket/a", strings.NewReader("a"))
+	Nil(t, err)
+	Nil(t, up.SignRequest(req))
+	Equal(t, counting.calls, 1)
+
+	// requests fail before they are sent, signing and verifying fail
+	failing := NewUpYun(&UpYunConfig{Bucket: "bucket", Credentials: &countingCredentials{err: errors.New("unavailable")}})
+	_, err = failing.GetInfo("/a")
+	NotNil(t, err)
+	Equal(t, strings.Contains(err.Error(), "credentials"), true)
+	NotNil(t, failing.SignRequest(req))
+	_, err = failing.PresignRequest(&PresignConfig{Path: "/a"})
+	NotNil(t, err)
+	_, err = failing.MakeFormToken(&FormPolicy{SaveKey: "/a"})
+	NotNil(t, err)
+	NotNil(t, failing.VerifyReturnURL(url.Values{"code": {"200"}, "sign": {"sign"}}))
+	Equal(t, failing.MakeUnifiedAuth(config), "")
+}
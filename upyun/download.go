@@ -0,0 +1,271 @@
+package upyun
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	defaultResumeGetConcurrency = 4
+	downloadTempSuffix          = ".upyun-download"
+)
+
+// DownloadPointConfig is the progress of a resume download.
+type DownloadPointConfig struct {
+	Path     string // remote path
+	TempPath string
+	PartSize int64
+	FileSize int64
+	MD5      string    // md5 of the remote file when the download started
+	FileTime time.Time // last modified time of the remote file
+	Parts    []int     // ids of the parts already written to TempPath
+	LastTime time.Time
+}
+
+func isDownloadPointExpired(point *DownloadPointConfig, path string, fInfo *FileInfo, ttl time.Duration) bool {
+	if point.Path != path || point.FileSize != fInfo.Size || point.MD5 != fInfo.MD5 ||
+		!point.FileTime.Equal(fInfo.Time) || point.LastTime.Add(ttl).Before(time.Now()) {
+		return true
+	}
+	stat, err := os.Stat(point.TempPath)
+	return err != nil || stat.Size() != point.FileSize
+}
+
+// resumeGet downloads config.Path to config.LocalPath by ranges fetched
+// concurrently into a temporary file, which is renamed to LocalPath once it
+// is complete and its md5 matches the remote file.
+func (up *UpYun) resumeGet(ctx context.Context, config *GetObjectConfig) (*FileInfo, error) {
+	if config.LocalPath == "" {
+		return nil, errors.New("resume download needs LocalPath")
+	}
+	fInfo, err := up.GetInfoWithHeadersContext(ctx, config.Path, config.Headers)
+	if err != nil {
+		return nil, errorOperation(fmt.Sprintf("get %s", config.Path), err)
+	}
+	if fInfo.IsDir {
+		return nil, fmt.Errorf("get %s: is a directory", config.Path)
+	}
+
+	partSize, _, err := getPartInfo(config.ResumePartSize, 0)
+	if err != nil {
+		return nil, errorOperation("resume download", err)
+	}
+
+	var point *DownloadPointConfig
+	if up.downloadRecorder != nil {
+		point = up.downloadRecorder.Get(config.LocalPath)
+	}
+	if point == nil || isDownloadPointExpired(point, config.Path, fInfo, recordTTL(up.downloadRecorder)) {
+		point = &DownloadPointConfig{
+			Path:     config.Path,
+			TempPath: config.LocalPath + downloadTempSuffix,
+			PartSize: partSize,
+			FileSize: fInfo.Size,
+			MD5:      fInfo.MD5,
+			FileTime: fInfo.Time,
+			LastTime: time.Now(),
+		}
+		if err = os.Remove(point.TempPath); err != nil && !os.IsNotExist(err) {
+			return nil, errorOperation("remove temp file", err)
+		}
+	}
+
+	partNum := int((point.FileSize + point.PartSize - 1) / point.PartSize)
+	var doneBytes int64
+	for _, id := range point.Parts {
+		doneBytes += partLength(point, id)
+	}
+	progressFromContext(ctx).setParts(point.FileSize, partNum, len(point.Parts), doneBytes)
+
+	fd, err := os.OpenFile(point.TempPath, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, errorOperation("create file", err)
+	}
+	if err = fd.Truncate(point.FileSize); err != nil {
+		fd.Close()
+		return nil, errorOperation("truncate file", err)
+	}
+
+	err = up.downloadParts(ctx, config, point, fd)
+	if err == nil {
+		err = fd.Sync()
+	}
+	if err == nil && point.MD5 != "" {
+		var sum string
+		if sum, err = md5File(fd); err == nil && sum != point.MD5 {
+			err = fmt.Errorf("md5 mismatch: %s != %s", sum, point.MD5)
+			point.Parts = nil
+		}
+	}
+	fd.Close()
+
+	if err != nil {
+		// nothing can resume the temporary file without a recorder
+		if up.downloadRecorder == nil || len(point.Parts) == 0 {
+			os.Remove(point.TempPath)
+			if up.downloadRecorder != nil {
+				up.downloadRecorder.Delete(config.LocalPath)
+			}
+		} else {
+			point.LastTime = time.Now()
+			up.downloadRecorder.Set(config.LocalPath, point)
+		}
+		return nil, errorOperation(fmt.Sprintf("resume download %s", config.Path), err)
+	}
+
+	if err = os.Rename(point.TempPath, config.LocalPath); err != nil {
+		return nil, errorOperation("rename file", err)
+	}
+	if up.downloadRecorder != nil {
+		up.downloadRecorder.Delete(config.LocalPath)
+	}
+	fInfo.Name = config.Path
+	return fInfo, nil
+}
+
+// downloadParts fetches the parts missing from point into fd, the first
+// failure cancels the other workers.
+func (up *UpYun) downloadParts(ctx context.Context, config *GetObjectConfig, point *DownloadPointConfig, fd *os.File) error {
+	partNum := int((point.FileSize + point.PartSize - 1) / point.PartSize)
+	done := make(map[int]bool, len(point.Parts))
+	for _, id := range point.Parts {
+		done[id] = true
+	}
+
+	concurrency := config.ResumeConcurrency
+	if concurrency <= 0 {
+		concurrency = defaultResumeGetConcurrency
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var (
+		wg       sync.WaitGroup
+		mu       sync.Mutex
+		once     sync.Once
+		firstErr error
+	)
+	parts := make(chan int)
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for id := range parts {
+				offset, n := int64(id)*point.PartSize, partLength(point, id)
+				err := up.retryPart(ctx, config.MaxResumeGetTries, func(ctx context.Context) error {
+					return up.downloadRange(ctx, config, fd, offset, n)
+				})
+				if err != nil {
+					once.Do(func() {
+						firstErr = err
+						cancel()
+					})
+					return
+				}
+
+				progressFromContext(ctx).partDone()
+				mu.Lock()
+				point.Parts = append(point.Parts, id)
+				sort.Ints(point.Parts)
+				point.LastTime = time.Now()
+				if up.downloadRecorder != nil {
+					up.downloadRecorder.Set(config.LocalPath, point)
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+
+feed:
+	for id := 0; id < partNum; id++ {
+		if done[id] {
+			continue
+		}
+		select {
+		case parts <- id:
+		case <-ctx.Done():
+			break feed
+		}
+	}
+	close(parts)
+	wg.Wait()
+
+	if firstErr != nil {
+		return firstErr
+	}
+	return ctx.Err()
+}
+
+// downloadRange writes n bytes of the remote file from offset into fd.
+func (up *UpYun) downloadRange(ctx context.Context, config *GetObjectConfig, fd *os.File, offset, n int64) (err error) {
+	headers := make(map[string]string, len(config.Headers)+2)
+	for k, v := range config.Headers {
+		headers[k] = v
+	}
+	headers["x-upyun-folder"] = "false"
+	headers["Range"] = fmt.Sprintf("bytes=%d-%d", offset, offset+n-1)
+
+	resp, err := up.doRESTRequest(ctx, &restReqConfig{
+		method:  "GET",
+		uri:     config.Path,
+		headers: headers,
+	})
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	body := io.Reader(resp.Body)
+	// the whole file is sent when the range is ignored
+	if resp.StatusCode != http.StatusPartialContent && offset > 0 {
+		if _, err = io.CopyN(io.Discard, body, offset); err != nil {
+			return err
+		}
+	}
+	body = io.LimitReader(body, n)
+	if progress := progressFromContext(ctx); progress != nil {
+		pr := progress.reader(body)
+		defer func() {
+			if err != nil {
+				pr.rollback()
+			}
+		}()
+		body = pr
+	}
+	written, err := io.Copy(&offsetWriter{w: fd, offset: offset}, body)
+	if err != nil {
+		return err
+	}
+	if written != n {
+		return io.ErrUnexpectedEOF
+	}
+	return nil
+}
+
+// partLength returns the size of the id-th part of point.
+func partLength(point *DownloadPointConfig, id int) int64 {
+	offset := int64(id) * point.PartSize
+	if point.FileSize-offset < point.PartSize {
+		return point.FileSize - offset
+	}
+	return point.PartSize
+}
+
+type offsetWriter struct {
+	w      io.WriterAt
+	offset int64
+}
+
+func (w *offsetWriter) Write(p []byte) (n int, err error) {
+	n, err = w.w.WriteAt(p, w.offset)
+	w.offset += int64(n)
+	return n, err
+}
@@ -0,0 +1,46 @@
+package upyun
+
+import (
+	"bytes"
+	"os"
+	"path"
+	"testing"
+)
+
+func TestResumeDownload(t *testing.T) {
+	data := bytes.Repeat([]byte("UPYUN"), 3*DefaultPartSize/5+100)
+	key := path.Join(ROOT, "DOWNLOAD", "FILE")
+	w, err := up.NewWriter(key, nil)
+	Nil(t, err)
+	_, err = w.Write(data)
+	Nil(t, err)
+	Nil(t, w.Close())
+
+	localPath := TempLocalFile(t)
+	defer os.Remove(localPath)
+
+	recorder := &MemoryDownloadRecorder{}
+	up.SetDownloadRecorder(recorder)
+	fInfo, err := up.Get(&GetObjectConfig{
+		Path:              key,
+		LocalPath:         localPath,
+		UseResumeDownload: true,
+		ResumeConcurrency: 2,
+		MaxResumeGetTries: 3,
+	})
+	Nil(t, err)
+	Equal(t, fInfo.Size, int64(len(data)))
+
+	var nilPoint *DownloadPointConfig
+	Equal(t, recorder.Get(localPath), nilPoint)
+
+	b, err := os.ReadFile(localPath)
+	Nil(t, err)
+	Equal(t, bytes.Equal(b, data), true)
+
+	_, err = os.Stat(localPath + downloadTempSuffix)
+	Equal(t, os.IsNotExist(err), true)
+
+	err = up.Delete(&DeleteObjectConfig{Path: key})
+	Nil(t, err)
+}
@@ -0,0 +1,40 @@
+//go:build !darwin && !dragonfly && !freebsd && !linux && !netbsd && !openbsd
+// +build !darwin,!dragonfly,!freebsd,!linux,!netbsd,!openbsd
+
+package upyun
+
+import (
+	"os"
+	"time"
+)
+
+// a lock file older than this was left by a crashed process
+const staleLockAge = 30 * time.Second
+
+type fileLock struct {
+	name string
+}
+
+// lockFile creates name exclusively, waiting while another process holds it.
+func lockFile(name string) (*fileLock, error) {
+	name += ".excl"
+	for {
+		f, err := os.OpenFile(name, os.O_RDWR|os.O_CREATE|os.O_EXCL, 0644)
+		if err == nil {
+			f.Close()
+			return &fileLock{name: name}, nil
+		}
+		if !os.IsExist(err) {
+			return nil, err
+		}
+		if info, err := os.Stat(name); err == nil && time.Since(info.ModTime()) > staleLockAge {
+			os.Remove(name)
+			continue
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func (l *fileLock) unlock() {
+	os.Remove(l.name)
+}
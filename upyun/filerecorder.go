@@ -0,0 +1,249 @@
+package upyun
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultRecordTTL = 24 * time.Hour
+	recordSuffix     = ".json"
+	recordLockName   = "LOCK"
+)
+
+// FileRecorder keeps breakpoints in a directory, one JSON file per remote
+// path, so that uploads can be resumed after the process restarts. Files are
+// written to a temporary file, synced and renamed in place, and a lock file
+// serializes the processes sharing the directory.
+type FileRecorder struct {
+	store *recordStore
+}
+
+// NewFileRecorder returns a recorder in dir, records not updated within ttl
+// are removed by TimedClearance, ttl defaults to 24h.
+func NewFileRecorder(dir string, ttl time.Duration) (*FileRecorder, error) {
+	store, err := newRecordStore(dir, ttl)
+	if err != nil {
+		return nil, err
+	}
+	return &FileRecorder{store: store}, nil
+}
+
+func (recorder *FileRecorder) Get(path string) *BreakPointConfig {
+	breakpoint := &BreakPointConfig{}
+	if !recorder.store.get(path, breakpoint) {
+		return nil
+	}
+	return breakpoint
+}
+
+func (recorder *FileRecorder) Set(path string, breakpoint *BreakPointConfig) {
+	recorder.store.set(path, breakpoint)
+}
+
+func (recorder *FileRecorder) Delete(path string) {
+	recorder.store.delete(path)
+}
+
+func (recorder *FileRecorder) TTL() time.Duration {
+	return recorder.store.ttl
+}
+
+func (recorder *FileRecorder) TimedClearance() {
+	recorder.store.clear(func(b []byte) time.Time {
+		var record struct{ Value BreakPointConfig }
+		json.Unmarshal(b, &record)
+		return record.Value.LastTime
+	})
+}
+
+// FileDownloadRecorder is the FileRecorder of resume downloads.
+type FileDownloadRecorder struct {
+	store *recordStore
+}
+
+func NewFileDownloadRecorder(dir string, ttl time.Duration) (*FileDownloadRecorder, error) {
+	store, err := newRecordStore(dir, ttl)
+	if err != nil {
+		return nil, err
+	}
+	return &FileDownloadRecorder{store: store}, nil
+}
+
+func (recorder *FileDownloadRecorder) TTL() time.Duration {
+	return recorder.store.ttl
+}
+
+func (recorder *FileDownloadRecorder) Get(localPath string) *DownloadPointConfig {
+	point := &DownloadPointConfig{}
+	if !recorder.store.get(localPath, point) {
+		return nil
+	}
+	return point
+}
+
+func (recorder *FileDownloadRecorder) Set(localPath string, point *DownloadPointConfig) {
+	recorder.store.set(localPath, point)
+}
+
+func (recorder *FileDownloadRecorder) Delete(localPath string) {
+	recorder.store.delete(localPath)
+}
+
+func (recorder *FileDownloadRecorder) TimedClearance() {
+	recorder.store.clear(func(b []byte) time.Time {
+		var record struct{ Value DownloadPointConfig }
+		json.Unmarshal(b, &record)
+		return record.Value.LastTime
+	})
+}
+
+// recordStore is a directory of JSON records by key. The Recorder interface
+// has no way to report errors, failed reads are missing records and failed
+// writes are dropped.
+type recordStore struct {
+	dir string
+	ttl time.Duration
+	mu  sync.Mutex
+}
+
+type fileRecord struct {
+	Key   string
+	Value interface{}
+}
+
+func newRecordStore(dir string, ttl time.Duration) (*recordStore, error) {
+	if ttl <= 0 {
+		ttl = defaultRecordTTL
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, errorOperation("create record dir", err)
+	}
+	return &recordStore{dir: dir, ttl: ttl}, nil
+}
+
+func (s *recordStore) file(key string) string {
+	return filepath.Join(s.dir, md5Str(key)+recordSuffix)
+}
+
+// lock serializes the goroutines of this process, and the processes sharing
+// the directory.
+func (s *recordStore) lock() (unlock func(), err error) {
+	s.mu.Lock()
+	l, err := lockFile(filepath.Join(s.dir, recordLockName))
+	if err != nil {
+		s.mu.Unlock()
+		return nil, err
+	}
+	return func() {
+		l.unlock()
+		s.mu.Unlock()
+	}, nil
+}
+
+func (s *recordStore) get(key string, value interface{}) bool {
+	unlock, err := s.lock()
+	if err != nil {
+		return false
+	}
+	defer unlock()
+
+	b, err := os.ReadFile(s.file(key))
+	if err != nil {
+		return false
+	}
+	record := &fileRecord{Value: value}
+	// md5 collisions aside, the key tells a record from a corrupt one
+	return json.Unmarshal(b, record) == nil && record.Key == key
+}
+
+func (s *recordStore) set(key string, value interface{}) {
+	b, err := json.Marshal(&fileRecord{Key: key, Value: value})
+	if err != nil {
+		return
+	}
+	unlock, err := s.lock()
+	if err != nil {
+		return
+	}
+	defer unlock()
+	writeFileAtomic(s.file(key), b)
+}
+
+func (s *recordStore) delete(key string) {
+	unlock, err := s.lock()
+	if err != nil {
+		return
+	}
+	defer unlock()
+	os.Remove(s.file(key))
+}
+
+// clear removes the records whose last update, given by lastTime or by the
+// modification time of the file, is older than the TTL.
+func (s *recordStore) clear(lastTime func(b []byte) time.Time) {
+	unlock, err := s.lock()
+	if err != nil {
+		return
+	}
+	defer unlock()
+
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return
+	}
+	deadline := time.Now().Add(-s.ttl)
+	for _, entry := range entries {
+		name := filepath.Join(s.dir, entry.Name())
+		// temporary files left by a crash are cleared as well
+		if !strings.HasSuffix(entry.Name(), recordSuffix) && !strings.HasSuffix(entry.Name(), ".tmp") {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		t := info.ModTime()
+		if b, err := os.ReadFile(name); err == nil {
+			if last := lastTime(b); !last.IsZero() {
+				t = last
+			}
+		}
+		if t.Before(deadline) {
+			os.Remove(name)
+		}
+	}
+}
+
+// writeFileAtomic replaces name by b, so that a crash leaves either the old
+// or the new content.
+func writeFileAtomic(name string, b []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(name), filepath.Base(name)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	_, err = tmp.Write(b)
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), name)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	// make the rename durable, not supported everywhere
+	if dir, err := os.Open(filepath.Dir(name)); err == nil {
+		dir.Sync()
+		dir.Close()
+	}
+	return nil
+}
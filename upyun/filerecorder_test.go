@@ -0,0 +1,120 @@
+package upyun
+
+import (
+	"fmt"
+	"os"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestFileRecorder(t *testing.T) {
+	dir := TempLocalDir(t)
+	defer os.RemoveAll(dir)
+
+	recorder, err := NewFileRecorder(dir, time.Hour)
+	Nil(t, err)
+	Equal(t, recorder.Get("/a"), (*BreakPointConfig)(nil))
+
+	breakpoint := &BreakPointConfig{
+		UploadID: "id",
+		PartID:   3,
+		PartSize: DefaultPartSize,
+		LastTime: time.Now().Round(0),
+	}
+	recorder.Set("/a", breakpoint)
+
+	// another process opening the same directory
+	reopened, err := NewFileRecorder(dir, time.Hour)
+	Nil(t, err)
+	got := reopened.Get("/a")
+	NotNil(t, got)
+	Equal(t, got.UploadID, "id")
+	Equal(t, got.PartID, 3)
+	Equal(t, got.LastTime.Equal(breakpoint.LastTime), true)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			reopened.Set(fmt.Sprintf("/b%d", i), &BreakPointConfig{PartID: i, LastTime: time.Now()})
+		}(i)
+	}
+	wg.Wait()
+	Equal(t, recorder.Get("/b7").PartID, 7)
+
+	recorder.Set("/old", &BreakPointConfig{LastTime: time.Now().Add(-2 * time.Hour)})
+	recorder.TimedClearance()
+	Equal(t, recorder.Get("/old"), (*BreakPointConfig)(nil))
+	NotNil(t, recorder.Get("/a"))
+
+	recorder.Delete("/a")
+	Equal(t, reopened.Get("/a"), (*BreakPointConfig)(nil))
+}
+
+func TestFileDownloadRecorder(t *testing.T) {
+	dir := TempLocalDir(t)
+	defer os.RemoveAll(dir)
+
+	recorder, err := NewFileDownloadRecorder(dir, 0)
+	Nil(t, err)
+	recorder.Set("/local", &DownloadPointConfig{Path: "/remote", Parts: []int{0, 2}, LastTime: time.Now()})
+	point := recorder.Get("/local")
+	NotNil(t, point)
+	Equal(t, point.Parts, []int{0, 2})
+
+	recorder.Set("/stale", &DownloadPointConfig{LastTime: time.Now().Add(-25 * time.Hour)})
+	recorder.TimedClearance()
+	Equal(t, recorder.Get("/stale"), (*DownloadPointConfig)(nil))
+	NotNil(t, recorder.Get("/local"))
+}
+
+func TestRecordTTL(t *testing.T) {
+	dir := TempLocalDir(t)
+	defer os.RemoveAll(dir)
+	recorder, err := NewFileRecorder(dir, time.Hour)
+	Nil(t, err)
+	Equal(t, recordTTL(recorder), time.Hour)
+	Equal(t, recordTTL(&MemoryRecorder{}), defaultRecordTTL)
+
+	memory := &MemoryRecorder{RecordTTL: time.Minute}
+	memory.Set("/fresh", &BreakPointConfig{LastTime: time.Now()})
+	memory.Set("/stale", &BreakPointConfig{LastTime: time.Now().Add(-2 * time.Minute)})
+	memory.TimedClearance()
+	NotNil(t, memory.Get("/fresh"))
+	Equal(t, memory.Get("/stale"), (*BreakPointConfig)(nil))
+
+	stat, err := os.Stat(dir)
+	Nil(t, err)
+	breakpoint := &BreakPointConfig{
+		FileSize:    stat.Size(),
+		FileModTime: stat.ModTime(),
+		LastTime:    time.Now().Add(-2 * time.Minute),
+	}
+	Equal(t, isRecordExpired(stat, breakpoint, "", time.Hour), false)
+	Equal(t, isRecordExpired(stat, breakpoint, "", time.Minute), true)
+}
+
+func TestFileRecorderResumable(t *testing.T) {
+	dir := TempLocalDir(t)
+	defer os.RemoveAll(dir)
+	stat, err := os.Stat(dir)
+	Nil(t, err)
+
+	recorder, err := NewFileRecorder(dir, time.Hour)
+	Nil(t, err)
+	recorder.Set("/a", &BreakPointConfig{
+		UploadID:    "id",
+		FileSize:    stat.Size(),
+		FileModTime: stat.ModTime(),
+		LastTime:    time.Now(),
+	})
+
+	// the time read back has lost the location and monotonic clock of Stat
+	reopened, err := NewFileRecorder(dir, time.Hour)
+	Nil(t, err)
+	breakpoint := reopened.Get("/a")
+	NotNil(t, breakpoint)
+	Equal(t, isRecordExpired(stat, breakpoint, "", time.Hour), false)
+}
@@ -2,16 +2,23 @@ package upyun
 
 import (
 	"bytes"
+	"context"
+	"crypto/subtle"
 	"encoding/json"
 	"fmt"
 	"io"
 	"mime/multipart"
 	"net/http"
+	"net/url"
 	"os"
 	"path/filepath"
+	"strconv"
+	"strings"
 	"time"
 )
 
+const defaultFormExpire = 30 * time.Minute
+
 type FormUploadConfig struct {
 	LocalPath      string
 	SaveKey        string
@@ -19,6 +26,91 @@ type FormUploadConfig struct {
 	NotifyUrl      string
 	Apps           []map[string]interface{}
 	Options        map[string]interface{}
+	// Policy: typed options, the other fields and Options take precedence
+	Policy   *FormPolicy
+	Progress ProgressFunc
+}
+
+// FormRange is an inclusive min,max range of a form policy.
+type FormRange struct {
+	Min int64
+	Max int64
+}
+
+func (r *FormRange) String() string {
+	return fmt.Sprintf("%d,%d", r.Min, r.Max)
+}
+
+// FormPolicy is the policy of a form upload, the zero fields are left out.
+type FormPolicy struct {
+	// SaveKey: path of the file, with placeholders such as {year} {mon}
+	// {day} {hour} {min} {sec} {filename} {suffix} {.suffix} {filemd5}
+	// {random32}, e.g. "/upload/{year}{mon}{day}/{filemd5}{.suffix}"
+	SaveKey string
+	// Expiration: default 30 minutes from the signing
+	Expiration time.Time
+	Date       string
+	ContentMD5 string
+	// ContentLengthRange: allowed file size in bytes
+	ContentLengthRange *FormRange
+	// AllowFileType: extensions, e.g. "jpg", "png"
+	AllowFileType    []string
+	ImageWidthRange  *FormRange
+	ImageHeightRange *FormRange
+	NotifyURL        string
+	ReturnURL        string
+	XGmkerlThumb     string
+	Apps             []map[string]interface{}
+	// Extra: other policy fields
+	Extra map[string]interface{}
+}
+
+// Options returns the policy fields by name.
+func (p *FormPolicy) Options() map[string]interface{} {
+	options := make(map[string]interface{})
+	for k, v := range p.Extra {
+		options[k] = v
+	}
+	set := func(k, v string) {
+		if v != "" {
+			options[k] = v
+		}
+	}
+	set("save-key", p.SaveKey)
+	set("date", p.Date)
+	set("content-md5", p.ContentMD5)
+	set("notify-url", p.NotifyURL)
+	set("return-url", p.ReturnURL)
+	set("x-gmkerl-thumb", p.XGmkerlThumb)
+	set("allow-file-type", strings.Join(p.AllowFileType, ","))
+	if !p.Expiration.IsZero() {
+		options["expiration"] = p.Expiration.Unix()
+	}
+	if p.ContentLengthRange != nil {
+		options["content-length-range"] = p.ContentLengthRange.String()
+	}
+	if p.ImageWidthRange != nil {
+		options["image-width-range"] = p.ImageWidthRange.String()
+	}
+	if p.ImageHeightRange != nil {
+		options["image-height-range"] = p.ImageHeightRange.String()
+	}
+	if len(p.Apps) > 0 {
+		options["apps"] = p.Apps
+	}
+	return options
+}
+
+// FormToken is what a browser or an app needs to post a file to the bucket
+// by itself: the fields policy and authorization, or signature with
+// deprecated auth, of the form posted to URL.
+type FormToken struct {
+	URL           string `json:"url"`
+	Policy        string `json:"policy"`
+	Authorization string `json:"authorization,omitempty"`
+	Signature     string `json:"signature,omitempty"`
+	// Expiration: unix time
+	Expiration int64 `json:"expiration"`
 }
 
 type FormUploadResp struct {
@@ -31,6 +123,7 @@ type FormUploadResp struct {
 	ImgFrames int      `json:"image-frames"`
 	ImgType   string   `json:"image-type"`
 	Sign      string   `json:"sign"`
+	ExtParam  string   `json:"ext-param"`
 	Taskids   []string `json:"task_ids"`
 }
 
@@ -38,6 +131,13 @@ func (config *FormUploadConfig) Format() {
 	if config.Options == nil {
 		config.Options = make(map[string]interface{})
 	}
+	if config.Policy != nil {
+		for k, v := range config.Policy.Options() {
+			if _, ok := config.Options[k]; !ok {
+				config.Options[k] = v
+			}
+		}
+	}
 	if config.SaveKey != "" {
 		config.Options["save-key"] = config.SaveKey
 	}
@@ -53,39 +153,27 @@ func (config *FormUploadConfig) Format() {
 }
 
 func (up *UpYun) FormUpload(config *FormUploadConfig) (*FormUploadResp, error) {
+	return up.FormUploadContext(context.Background(), config)
+}
+
+func (up *UpYun) FormUploadContext(ctx context.Context, config *FormUploadConfig) (*FormUploadResp, error) {
 	config.Format()
-	config.Options["bucket"] = up.Bucket
+	ctx = withProgress(ctx, newProgressTracker(config.Progress, config.SaveKey))
 
-	args, err := json.Marshal(config.Options)
+	token, err := up.signForm(config.Options)
 	if err != nil {
 		return nil, err
 	}
-	policy := base64ToStr(args)
-
 	formValues := make(map[string]string)
-	formValues["policy"] = policy
+	formValues["policy"] = token.Policy
 	formValues["file"] = config.LocalPath
-
 	if up.deprecated {
-		formValues["signature"] = up.MakeFormAuth(policy)
+		formValues["signature"] = token.Signature
 	} else {
-		sign := &UnifiedAuthConfig{
-			Method: "POST",
-			Uri:    "/" + up.Bucket,
-			Policy: policy,
-		}
-		if v, ok := config.Options["date"]; ok {
-			sign.DateStr = v.(string)
-		}
-		if v, ok := config.Options["content-md5"]; ok {
-			sign.ContentMD5 = v.(string)
-		}
-		formValues["authorization"] = up.MakeUnifiedAuth(sign)
+		formValues["authorization"] = token.Authorization
 	}
 
-	endpoint := up.getEndpoint("v0.api.upyun.com")
-	url := fmt.Sprintf("%s/%s", endpoint, up.Bucket)
-	resp, err := up.doFormRequest(url, formValues)
+	resp, err := up.doFormRequest(ctx, token.URL, formValues)
 	if err != nil {
 		return nil, err
 	}
@@ -102,7 +190,132 @@ func (up *UpYun) FormUpload(config *FormUploadConfig) (*FormUploadResp, error) {
 	return &r, err
 }
 
-func (up *UpYun) doFormRequest(url string, formValues map[string]string) (*http.Response, error) {
+// MakeFormToken signs policy without uploading anything, so that an API can
+// hand out upload credentials to clients posting directly to UpYun.
+func (up *UpYun) MakeFormToken(policy *FormPolicy) (*FormToken, error) {
+	options := policy.Options()
+	if _, ok := options["expiration"]; !ok {
+		options["expiration"] = time.Now().Add(defaultFormExpire).Unix()
+	}
+	return up.signForm(options)
+}
+
+// signForm adds the bucket to options and signs them.
+func (up *UpYun) signForm(options map[string]interface{}) (*FormToken, error) {
+	keys, err := up.signingKeys()
+	if err != nil {
+		return nil, errorOperation("sign form", err)
+	}
+	options["bucket"] = up.Bucket
+	args, err := json.Marshal(options)
+	if err != nil {
+		return nil, err
+	}
+	token := &FormToken{
+		URL:    fmt.Sprintf("%s/%s", up.getEndpoint("v0.api.upyun.com"), up.Bucket),
+		Policy: base64ToStr(args),
+	}
+	switch v := options["expiration"].(type) {
+	case int64:
+		token.Expiration = v
+	case int:
+		token.Expiration = int64(v)
+	}
+
+	if up.deprecated {
+		token.Signature = makeFormAuth(keys, token.Policy)
+		return token, nil
+	}
+	sign := &UnifiedAuthConfig{
+		Method: "POST",
+		Uri:    "/" + up.Bucket,
+		Policy: token.Policy,
+	}
+	if v, ok := options["date"].(string); ok {
+		sign.DateStr = v
+	}
+	if v, ok := options["content-md5"].(string); ok {
+		sign.ContentMD5 = v
+	}
+	token.Authorization = makeUnifiedAuth(keys, sign)
+	return token, nil
+}
+
+// VerifyFormResp checks the sign of the response of a form upload, see
+// VerifyReturnURL.
+func (up *UpYun) VerifyFormResp(resp *FormUploadResp) error {
+	values := url.Values{
+		"code":      {strconv.Itoa(resp.Code)},
+		"message":   {resp.Msg},
+		"url":       {resp.Url},
+		"time":      {strconv.FormatInt(resp.Timestamp, 10)},
+		"ext-param": {resp.ExtParam},
+		"sign":      {resp.Sign},
+	}
+	keys, err := up.signingKeys()
+	if err != nil {
+		return errorOperation("verify form response", err)
+	}
+	if !verifyFormSign(keys, values) {
+		return errorOperation("verify form response: invalid sign", nil)
+	}
+	return nil
+}
+
+// VerifyReturnURL checks the sign of the query of a return-url redirect:
+// with a Secret, the md5 of code&message&url&time&secret, followed by
+// &ext-param if any, as MakeFormAuth signs policies; otherwise the HMAC-SHA1
+// by the md5 of the password of the non-empty code&message&url&time&ext-param,
+// as MakeUnifiedAuth signs requests.
+func (up *UpYun) VerifyReturnURL(query url.Values) error {
+	keys, err := up.signingKeys()
+	if err != nil {
+		return errorOperation("verify return url", err)
+	}
+	if !verifyFormSign(keys, query) {
+		return errorOperation("verify return url: invalid sign", nil)
+	}
+	return nil
+}
+
+func verifyFormSign(keys *signKeys, values url.Values) bool {
+	sign := values.Get("sign")
+	if sign == "" {
+		return false
+	}
+	password, secret := keys.password, keys.secret
+	if secret != "" {
+		legacy := []string{
+			values.Get("code"),
+			values.Get("message"),
+			values.Get("url"),
+			values.Get("time"),
+			secret,
+		}
+		if v := values.Get("ext-param"); v != "" {
+			legacy = append(legacy, v)
+		}
+		expect := md5Str(strings.Join(legacy, "&"))
+		if subtle.ConstantTimeCompare([]byte(expect), []byte(strings.ToLower(sign))) == 1 {
+			return true
+		}
+	}
+	if password != md5Str("") {
+		var unified []string
+		for _, k := range []string{"code", "message", "url", "time", "ext-param"} {
+			if v := values.Get(k); v != "" {
+				unified = append(unified, v)
+			}
+		}
+		expect := base64ToStr(hmacSha1(password, []byte(strings.Join(unified, "&"))))
+		if subtle.ConstantTimeCompare([]byte(expect), []byte(sign)) == 1 {
+			return true
+		}
+	}
+	return false
+}
+
+func (up *UpYun) doFormRequest(ctx context.Context, url string, formValues map[string]string) (*http.Response, error) {
 	formBody := &bytes.Buffer{}
 	formWriter := multipart.NewWriter(formBody)
 	defer formWriter.Close()
@@ -139,7 +352,7 @@ func (up *UpYun) doFormRequest(url string, formValues map[string]string) (*http.
 	}
 
 	body := io.MultiReader(formBody, fd, bdBuf)
-	resp, err := up.doHTTPRequest("POST", url, headers, body)
+	resp, err := up.doHTTPRequest(ctx, "POST", url, headers, body, nil)
 	if err != nil {
 		return nil, errorOperation("form", err)
 	}
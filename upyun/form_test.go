@@ -1,6 +1,9 @@
 package upyun
 
 import (
+	"encoding/base64"
+	"encoding/json"
+	"net/url"
 	"path"
 	"testing"
 )
@@ -50,3 +53,62 @@ func TestFormPutApps(t *testing.T) {
 	Nil(t, err)
 	Equal(t, len(resp.Taskids), 3)
 }
+
+func TestFormPolicy(t *testing.T) {
+	policy := &FormPolicy{
+		SaveKey:            path.Join(ROOT, "FORM", "{filemd5}{.suffix}"),
+		ContentLengthRange: &FormRange{Min: 0, Max: 1024 * 1024},
+		AllowFileType:      []string{"jpg", "png"},
+		ImageWidthRange:    &FormRange{Min: 1, Max: 4096},
+		ReturnURL:          "https://example.com/done",
+		Extra:              map[string]interface{}{"x-upyun-meta-from": "test"},
+	}
+	token, err := up.MakeFormToken(policy)
+	Nil(t, err)
+	Equal(t, token.Authorization, up.MakeUnifiedAuth(&UnifiedAuthConfig{
+		Method: "POST",
+		Uri:    "/" + up.Bucket,
+		Policy: token.Policy,
+	}))
+
+	b, err := base64.StdEncoding.DecodeString(token.Policy)
+	Nil(t, err)
+	var options map[string]interface{}
+	Nil(t, json.Unmarshal(b, &options))
+	Equal(t, options["bucket"], up.Bucket)
+	Equal(t, options["content-length-range"], "0,1048576")
+	Equal(t, options["allow-file-type"], "jpg,png")
+	Equal(t, options["image-width-range"], "1,4096")
+	Equal(t, options["x-upyun-meta-from"], "test")
+	Equal(t, int64(options["expiration"].(float64)), token.Expiration)
+	_, ok := options["notify-url"]
+	Equal(t, ok, false)
+
+	resp, err := up.FormUpload(&FormUploadConfig{
+		LocalPath:      LOCAL_FILE,
+		ExpireAfterSec: 60,
+		Policy:         &FormPolicy{SaveKey: FORM_FILE, ContentLengthRange: &FormRange{Min: 1, Max: 1024 * 1024}},
+	})
+	Nil(t, err)
+	Equal(t, resp.Code, 200)
+}
+
+func TestVerifyReturnURL(t *testing.T) {
+	legacy := NewUpYun(&UpYunConfig{Bucket: "bucket", Secret: "secret"})
+	query := url.Values{"code": {"200"}, "message": {"ok"}, "url": {"/a.jpg"}, "time": {"1700000000"}}
+	query.Set("sign", md5Str("200&ok&/a.jpg&1700000000&secret"))
+	Nil(t, legacy.VerifyReturnURL(query))
+	query.Set("ext-param", "x")
+	NotNil(t, legacy.VerifyReturnURL(query))
+	query.Set("sign", md5Str("200&ok&/a.jpg&1700000000&secret&x"))
+	Nil(t, legacy.VerifyReturnURL(query))
+
+	unified := NewUpYun(&UpYunConfig{Bucket: "bucket", Operator: "operator", Password: "password"})
+	resp := &FormUploadResp{Code: 200, Msg: "ok", Url: "/a.jpg", Timestamp: 1700000000}
+	resp.Sign = base64ToStr(hmacSha1(md5Str("password"), []byte("200&ok&/a.jpg&1700000000")))
+	Nil(t, unified.VerifyFormResp(resp))
+	NotNil(t, legacy.VerifyFormResp(resp))
+	resp.Url = "/b.jpg"
+	NotNil(t, unified.VerifyFormResp(resp))
+	NotNil(t, unified.VerifyReturnURL(url.Values{"code": {"200"}}))
+}
@@ -0,0 +1,211 @@
+package upyun
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"io/fs"
+	"path"
+	"sort"
+	"time"
+)
+
+// FS is a read-only fs.FS over the bucket, rooted at a remote directory.
+type FS struct {
+	up   *UpYun
+	ctx  context.Context
+	root string
+}
+
+var (
+	_ fs.FS         = (*FS)(nil)
+	_ fs.StatFS     = (*FS)(nil)
+	_ fs.ReadDirFS  = (*FS)(nil)
+	_ fs.ReadFileFS = (*FS)(nil)
+)
+
+// NewFS returns a fs.FS of the remote directory root.
+func (up *UpYun) NewFS(root string) *FS {
+	return up.NewFSContext(context.Background(), root)
+}
+
+// NewFSContext returns a fs.FS of the remote directory root, whose requests
+// are made with ctx.
+func (up *UpYun) NewFSContext(ctx context.Context, root string) *FS {
+	return &FS{
+		up:   up,
+		ctx:  ctx,
+		root: path.Join("/", root),
+	}
+}
+
+func (fsys *FS) remotePath(op, name string) (string, error) {
+	if !fs.ValidPath(name) {
+		return "", &fs.PathError{Op: op, Path: name, Err: fs.ErrInvalid}
+	}
+	return path.Join(fsys.root, name), nil
+}
+
+func fsError(op, name string, err error) error {
+	if IsNotExist(err) {
+		err = fs.ErrNotExist
+	}
+	return &fs.PathError{Op: op, Path: name, Err: err}
+}
+
+func (fsys *FS) stat(op, name string) (string, *FileInfo, error) {
+	remote, err := fsys.remotePath(op, name)
+	if err != nil {
+		return "", nil, err
+	}
+	fInfo, err := fsys.up.GetInfoContext(fsys.ctx, remote)
+	if err != nil {
+		return "", nil, fsError(op, name, err)
+	}
+	fInfo.Name = path.Base(name)
+	return remote, fInfo, nil
+}
+
+func (fsys *FS) Open(name string) (fs.File, error) {
+	remote, fInfo, err := fsys.stat("open", name)
+	if err != nil {
+		return nil, err
+	}
+	if fInfo.IsDir {
+		return &fsDir{fsys: fsys, remote: remote, info: fInfo}, nil
+	}
+	return &fsFile{
+		ObjectReader: fsys.up.newObjectReader(fsys.ctx, remote, fInfo),
+		info:         fInfo,
+	}, nil
+}
+
+func (fsys *FS) Stat(name string) (fs.FileInfo, error) {
+	_, fInfo, err := fsys.stat("stat", name)
+	if err != nil {
+		return nil, err
+	}
+	return fInfo.FsFileInfo(), nil
+}
+
+func (fsys *FS) ReadDir(name string) ([]fs.DirEntry, error) {
+	remote, fInfo, err := fsys.stat("readdir", name)
+	if err != nil {
+		return nil, err
+	}
+	if !fInfo.IsDir {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: errors.New("not a directory")}
+	}
+
+	d := &fsDir{fsys: fsys, remote: remote, info: fInfo}
+	entries, err := d.ReadDir(-1)
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Name() < entries[j].Name()
+	})
+	return entries, nil
+}
+
+func (fsys *FS) ReadFile(name string) ([]byte, error) {
+	remote, err := fsys.remotePath("readfile", name)
+	if err != nil {
+		return nil, err
+	}
+	buf := &bytes.Buffer{}
+	if _, err = fsys.up.GetContext(fsys.ctx, &GetObjectConfig{
+		Path:   remote,
+		Writer: buf,
+	}); err != nil {
+		return nil, fsError("readfile", name, err)
+	}
+	return buf.Bytes(), nil
+}
+
+type fsFile struct {
+	*ObjectReader
+	info *FileInfo
+}
+
+func (f *fsFile) Stat() (fs.FileInfo, error) {
+	return f.info.FsFileInfo(), nil
+}
+
+type fsDir struct {
+	fsys   *FS
+	remote string
+	info   *FileInfo
+
+	entries []fs.DirEntry
+	iter    string
+	eof     bool
+}
+
+func (d *fsDir) Stat() (fs.FileInfo, error) {
+	return d.info.FsFileInfo(), nil
+}
+
+func (d *fsDir) Read([]byte) (int, error) {
+	return 0, &fs.PathError{Op: "read", Path: d.info.Name, Err: errors.New("is a directory")}
+}
+
+func (d *fsDir) Close() error {
+	return nil
+}
+
+// ReadDir lists the directory page by page as entries are asked for.
+func (d *fsDir) ReadDir(n int) ([]fs.DirEntry, error) {
+	for !d.eof && (n <= 0 || len(d.entries) < n) {
+		limit := MaxLimit
+		if n > 0 && n < limit {
+			limit = n
+		}
+		files, iter, err := d.fsys.up.ListObjectsContext(d.fsys.ctx, &ListObjectsConfig{
+			Path:  d.remote,
+			Iter:  d.iter,
+			Limit: limit,
+		})
+		if err != nil {
+			return nil, fsError("readdir", d.info.Name, err)
+		}
+		for _, fInfo := range files {
+			d.entries = append(d.entries, fs.FileInfoToDirEntry(fInfo.FsFileInfo()))
+		}
+		d.iter = iter
+		d.eof = iter == ""
+	}
+
+	entries := d.entries
+	if n > 0 && len(entries) > n {
+		entries = entries[:n]
+	}
+	d.entries = d.entries[len(entries):]
+	if n > 0 && len(entries) == 0 {
+		return nil, io.EOF
+	}
+	return entries, nil
+}
+
+// FsFileInfo adapts fInfo to fs.FileInfo, whose Sys returns fInfo.
+func (fInfo *FileInfo) FsFileInfo() fs.FileInfo {
+	return fsFileInfo{fInfo}
+}
+
+type fsFileInfo struct {
+	fInfo *FileInfo
+}
+
+func (i fsFileInfo) Name() string       { return path.Base(i.fInfo.Name) }
+func (i fsFileInfo) Size() int64        { return i.fInfo.Size }
+func (i fsFileInfo) ModTime() time.Time { return i.fInfo.Time }
+func (i fsFileInfo) IsDir() bool        { return i.fInfo.IsDir }
+func (i fsFileInfo) Sys() interface{}   { return i.fInfo }
+
+func (i fsFileInfo) Mode() fs.FileMode {
+	if i.fInfo.IsDir {
+		return fs.ModeDir | 0555
+	}
+	return 0444
+}
@@ -0,0 +1,52 @@
+package upyun
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"strings"
+	"testing"
+)
+
+func TestFS(t *testing.T) {
+	root := path.Join(ROOT, "FS")
+	files := []string{"a.txt", "d/b.txt", "d/e/c.txt"}
+	for _, name := range files {
+		err := up.Put(&PutObjectConfig{
+			Path:   path.Join(root, name),
+			Reader: strings.NewReader(name),
+			Headers: map[string]string{
+				"Content-Length": fmt.Sprint(len(name)),
+			},
+		})
+		Nil(t, err)
+	}
+
+	fsys := up.NewFS(root)
+	walked := []string{}
+	err := fs.WalkDir(fsys, ".", func(name string, d fs.DirEntry, err error) error {
+		if err == nil && !d.IsDir() {
+			walked = append(walked, name)
+		}
+		return err
+	})
+	Nil(t, err)
+	Equal(t, walked, files)
+
+	b, err := fs.ReadFile(fsys, "d/e/c.txt")
+	Nil(t, err)
+	Equal(t, string(b), "d/e/c.txt")
+
+	info, err := fs.Stat(fsys, "d")
+	Nil(t, err)
+	Equal(t, info.IsDir(), true)
+
+	_, err = fsys.Open("not-exist")
+	Equal(t, errors.Is(err, fs.ErrNotExist), true)
+
+	for _, name := range files {
+		err = up.Delete(&DeleteObjectConfig{Path: path.Join(root, name)})
+		Nil(t, err)
+	}
+}
@@ -2,17 +2,78 @@ package upyun
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"io"
 	"net/http"
 	"os"
 	"strconv"
 	"strings"
+	"time"
 )
 
-func (up *UpYun) doHTTPRequest(method, url string, headers map[string]string,
+// signFunc fills the Authorization of headers for their Date.
+type signFunc func(headers map[string]string) error
+
+// doHTTPRequest sends a request, retried by up.RetryPolicy if its body can
+// be sent again. If sign is not nil the headers are dated and signed before
+// every attempt, so that retries stay within the allowed clock skew.
+func (up *UpYun) doHTTPRequest(ctx context.Context, method, url string, headers map[string]string,
+	body io.Reader, sign signFunc) (resp *http.Response, err error) {
+	resign := func(headers map[string]string) error {
+		if sign == nil {
+			return nil
+		}
+		headers["Date"] = makeRFC1123Date(time.Now())
+		return sign(headers)
+	}
+	replayBody, rewind, ok := bodyRewinder(body)
+	if up.RetryPolicy == nil || !ok || noRetryFromContext(ctx) {
+		if err = resign(headers); err != nil {
+			return nil, err
+		}
+		return up.doHTTPRequestOnce(ctx, method, url, headers, body)
+	}
+
+	// the transport closes the request body after each attempt, so hide
+	// Close from it and fix the length up front
+	retryHeaders := make(map[string]string, len(headers)+1)
+	for k, v := range headers {
+		retryHeaders[k] = v
+	}
+	if replayBody != nil && (method == "PUT" || method == "POST") && !hasHeader(headers, "Content-Length") {
+		if n, found := getBodyLength(replayBody); found {
+			retryHeaders["Content-Length"] = strconv.FormatInt(n, 10)
+		}
+	}
+	if replayBody != nil {
+		replayBody = struct{ io.Reader }{replayBody}
+	}
+
+	for attempt := 1; ; attempt++ {
+		if err = resign(retryHeaders); err != nil {
+			return nil, err
+		}
+		resp, err = up.doHTTPRequestOnce(ctx, method, url, retryHeaders, replayBody)
+		if err == nil || ctx.Err() != nil {
+			return resp, err
+		}
+		delay, retry := up.RetryPolicy.Retry(attempt, err)
+		if !retry {
+			return nil, err
+		}
+		if sleepContext(ctx, delay) != nil || rewind() != nil {
+			return nil, err
+		}
+	}
+}
+
+func (up *UpYun) doHTTPRequestOnce(ctx context.Context, method, url string, headers map[string]string,
 	body io.Reader) (resp *http.Response, err error) {
-	req, err := http.NewRequest(method, url, body)
+	if err = up.RequestLimit.WaitN(ctx, 1); err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, method, url, body)
 	if err != nil {
 		return nil, err
 	}
@@ -33,40 +94,38 @@ func (up *UpYun) doHTTPRequest(method, url string, headers map[string]string,
 			req.ContentLength, _ = strconv.ParseInt(length, 10, 64)
 			found = true
 		} else {
-			switch v := body.(type) {
-			case *os.File:
-				if fInfo, err := v.Stat(); err == nil {
-					req.ContentLength = fInfo.Size()
-					found = true
-				}
-			case UpYunPutReader:
-				req.ContentLength = int64(v.Len())
-				found = true
-			case *bytes.Buffer:
-				req.ContentLength = int64(v.Len())
-				found = true
-			case *bytes.Reader:
-				req.ContentLength = int64(v.Len())
-				found = true
-			case *strings.Reader:
-				req.ContentLength = int64(v.Len())
-				found = true
-			case *io.LimitedReader:
-				req.ContentLength = v.N
-				found = true
-			}
+			req.ContentLength, found = getBodyLength(body)
 		}
 		if found && req.ContentLength == 0 {
 			req.Body = nil
 		}
 	}
 
+	if up.UploadLimit != nil && req.Body != nil {
+		req.Body = &rateLimitedReader{ctx: ctx, r: req.Body, l: up.UploadLimit}
+	}
+	if t := progressFromContext(ctx); t != nil && req.Body != nil {
+		if req.ContentLength > 0 {
+			t.setTotal(req.ContentLength)
+		}
+		pr := t.reader(req.Body)
+		req.Body = pr
+		defer func() {
+			if err != nil {
+				pr.rollback()
+			}
+		}()
+	}
+
 	//	fmt.Printf("%+v\n", req)
 
 	resp, err = up.httpc.Do(req)
 	if err != nil {
 		return nil, err
 	}
+	if up.DownloadLimit != nil {
+		resp.Body = &rateLimitedReader{ctx: ctx, r: resp.Body, l: up.DownloadLimit}
+	}
 	err = checkResponse(resp)
 	if err != nil {
 		return nil, err
@@ -74,6 +133,37 @@ func (up *UpYun) doHTTPRequest(method, url string, headers map[string]string,
 	return resp, nil
 }
 
+func getBodyLength(body io.Reader) (int64, bool) {
+	switch v := body.(type) {
+	case *os.File:
+		if fInfo, err := v.Stat(); err == nil {
+			return fInfo.Size(), true
+		}
+	case UpYunPutReader:
+		return int64(v.Len()), true
+	case *bytes.Buffer:
+		return int64(v.Len()), true
+	case *bytes.Reader:
+		return int64(v.Len()), true
+	case *strings.Reader:
+		return int64(v.Len()), true
+	case *io.LimitedReader:
+		return v.N, true
+	case *io.SectionReader:
+		return v.Size(), true
+	}
+	return 0, false
+}
+
+func hasHeader(headers map[string]string, key string) bool {
+	for k := range headers {
+		if strings.EqualFold(k, key) {
+			return true
+		}
+	}
+	return false
+}
+
 func (up *UpYun) doGetEndpoint(host string) string {
 	s := up.Hosts[host]
 	if s != "" {
@@ -0,0 +1,156 @@
+package upyun
+
+import (
+	"context"
+	"path"
+)
+
+// ObjectsConfig provides a configuration to Objects method.
+type ObjectsConfig struct {
+	Headers map[string]string
+	// MaxListLevel: depth of recursion, -1 for no limit
+	MaxListLevel int
+	// DescOrder: whether list objects by desc-order
+	DescOrder bool
+	// MaxListObjects: stop after this many objects, 0 for no limit
+	MaxListObjects int
+	// Limit: objects fetched by one request, default 256 and at most 4096
+	Limit int
+	// Deprecated: failed requests are retried by UpYun.RetryPolicy
+	MaxListTries int
+}
+
+// ObjectIterator walks a directory page by page as objects are asked for:
+//
+//	it := up.Objects("/dir", &ObjectsConfig{MaxListLevel: -1})
+//	for it.Next() {
+//		fInfo := it.Object()
+//	}
+//	if err := it.Err(); err != nil {
+//	}
+//
+// Objects in sub-directories are named relative to the listed directory and
+// come before the sub-directory itself, the same as List.
+type ObjectIterator struct {
+	up     *UpYun
+	ctx    context.Context
+	config ObjectsConfig
+
+	stack []*listFrame
+	cur   *FileInfo
+	num   int
+	err   error
+}
+
+type listFrame struct {
+	remote string
+	name   string // relative to the listed directory
+	level  int
+	dir    *FileInfo // emitted once the directory is walked through
+
+	files []*FileInfo
+	iter  string
+	eof   bool
+	num   int // objects emitted inside the directory
+}
+
+func (up *UpYun) Objects(path string, config *ObjectsConfig) *ObjectIterator {
+	return up.ObjectsContext(context.Background(), path, config)
+}
+
+func (up *UpYun) ObjectsContext(ctx context.Context, path string, config *ObjectsConfig) *ObjectIterator {
+	it := &ObjectIterator{
+		up:    up,
+		ctx:   ctx,
+		stack: []*listFrame{{remote: path}},
+	}
+	if config != nil {
+		it.config = *config
+	}
+	return it
+}
+
+// Next advances to the next object, it returns false when the listing is
+// finished or failed.
+func (it *ObjectIterator) Next() bool {
+	it.cur = nil
+	for it.err == nil && len(it.stack) > 0 {
+		if it.config.MaxListObjects > 0 && it.num >= it.config.MaxListObjects {
+			it.stack = nil
+			return false
+		}
+		if err := it.ctx.Err(); err != nil {
+			it.err = errorOperation("list", err)
+			return false
+		}
+
+		top := it.stack[len(it.stack)-1]
+		if len(top.files) == 0 {
+			if !top.eof {
+				it.err = it.fetch(top)
+				continue
+			}
+			it.stack = it.stack[:len(it.stack)-1]
+			if top.dir == nil {
+				continue
+			}
+			top.dir.IsEmptyDir = top.num == 0
+			return it.emit(top.dir)
+		}
+
+		fInfo := top.files[0]
+		top.files = top.files[1:]
+		remote := path.Join(top.remote, fInfo.Name)
+		fInfo.Name = path.Join(top.name, fInfo.Name)
+		if fInfo.IsDir && (top.level+1 < it.config.MaxListLevel || it.config.MaxListLevel == -1) {
+			it.stack = append(it.stack, &listFrame{
+				remote: remote,
+				name:   fInfo.Name,
+				level:  top.level + 1,
+				dir:    fInfo,
+			})
+			continue
+		}
+		return it.emit(fInfo)
+	}
+	return false
+}
+
+func (it *ObjectIterator) emit(fInfo *FileInfo) bool {
+	if len(it.stack) > 0 {
+		it.stack[len(it.stack)-1].num++
+	}
+	it.cur = fInfo
+	it.num++
+	return true
+}
+
+func (it *ObjectIterator) fetch(frame *listFrame) error {
+	headers := make(map[string]string, len(it.config.Headers))
+	for k, v := range it.config.Headers {
+		headers[k] = v
+	}
+	files, iter, err := it.up.ListObjectsContext(it.ctx, &ListObjectsConfig{
+		Path:         frame.remote,
+		Headers:      headers,
+		Iter:         frame.iter,
+		MaxListTries: it.config.MaxListTries,
+		DescOrder:    it.config.DescOrder,
+		Limit:        it.config.Limit,
+	})
+	if err != nil {
+		return err
+	}
+	frame.files, frame.iter, frame.eof = files, iter, iter == ""
+	return nil
+}
+
+// Object returns the current object.
+func (it *ObjectIterator) Object() *FileInfo {
+	return it.cur
+}
+
+// Err returns the error which stopped the iteration, if any.
+func (it *ObjectIterator) Err() error {
+	return it.err
+}
@@ -0,0 +1,44 @@
+package upyun
+
+import (
+	"fmt"
+	"path"
+	"strings"
+	"testing"
+)
+
+func TestObjects(t *testing.T) {
+	root := path.Join(ROOT, "OBJECTS")
+	files := []string{"a.txt", "d/b.txt", "d/e/c.txt"}
+	for _, name := range files {
+		err := up.Put(&PutObjectConfig{
+			Path:   path.Join(root, name),
+			Reader: strings.NewReader(name),
+			Headers: map[string]string{
+				"Content-Length": fmt.Sprint(len(name)),
+			},
+		})
+		Nil(t, err)
+	}
+
+	it := up.Objects(root, &ObjectsConfig{MaxListLevel: -1, Limit: 1})
+	names := []string{}
+	for it.Next() {
+		names = append(names, it.Object().Name)
+	}
+	Nil(t, it.Err())
+	Equal(t, names, []string{"a.txt", "d/b.txt", "d/e/c.txt", "d/e", "d"})
+
+	it = up.Objects(root, &ObjectsConfig{MaxListLevel: -1, MaxListObjects: 2})
+	names = []string{}
+	for it.Next() {
+		names = append(names, it.Object().Name)
+	}
+	Nil(t, it.Err())
+	Equal(t, names, []string{"a.txt", "d/b.txt"})
+
+	for _, name := range files {
+		err := up.Delete(&DeleteObjectConfig{Path: path.Join(root, name)})
+		Nil(t, err)
+	}
+}
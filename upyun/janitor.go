@@ -0,0 +1,153 @@
+package upyun
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"time"
+)
+
+const defaultMultipartMaxAge = 24 * time.Hour
+
+type CleanMultipartConfig struct {
+	Prefix string
+	// MaxAge: uploads created longer ago are stale, default 24h
+	MaxAge time.Duration
+	// Finalize: complete the stale uploads which are known to hold every
+	// part of their object. Other uploads are never completed, that would
+	// publish a truncated object at their path.
+	Finalize bool
+	// Limit: uploads listed per request, default DefaultLimit
+	Limit int64
+	// DryRun: only report the stale uploads to Output
+	DryRun bool
+	Output io.Writer
+}
+
+// StaleMultipartUpload is an unfinished multipart upload older than
+// CleanMultipartConfig.MaxAge.
+type StaleMultipartUpload struct {
+	Path      string
+	UploadID  string
+	CreatedAt time.Time
+	Age       time.Duration
+	// Parts and Bytes: the parts held by the server
+	Parts int
+	Bytes int64
+	// Whole: the parts are continuous and add up to the declared length of
+	// the upload, only checked with CleanMultipartConfig.Finalize
+	Whole     bool
+	Finalized bool
+	Err       error
+}
+
+func (u *StaleMultipartUpload) String() string {
+	s := fmt.Sprintf("%s %s age=%s parts=%d bytes=%d", u.Path, u.UploadID,
+		u.Age.Truncate(time.Second), u.Parts, u.Bytes)
+	if u.Finalized {
+		s += " finalized"
+	} else if u.Whole {
+		s += " whole"
+	}
+	if u.Err != nil {
+		s += ": " + u.Err.Error()
+	}
+	return s
+}
+
+func (up *UpYun) CleanMultipartUploads(config *CleanMultipartConfig) ([]*StaleMultipartUpload, error) {
+	return up.CleanMultipartUploadsContext(context.Background(), config)
+}
+
+// CleanMultipartUploadsContext pages through the unfinished multipart uploads
+// under config.Prefix and returns those older than config.MaxAge, with the
+// parts the server holds.
+//
+// The REST API has no way to abort a multipart upload: stale uploads are only
+// reported, and left for the server to expire. With config.Finalize the
+// uploads found whole are completed, which publishes their object. A partial
+// upload is never completed, as that would publish a truncated object at its
+// path. An upload is found whole only if it is the latest upload of its path,
+// as GetResumeProcess reports the declared length of that one alone.
+// Failures are reported by StaleMultipartUpload.Err.
+func (up *UpYun) CleanMultipartUploadsContext(ctx context.Context, config *CleanMultipartConfig) ([]*StaleMultipartUpload, error) {
+	maxAge := config.MaxAge
+	if maxAge <= 0 {
+		maxAge = defaultMultipartMaxAge
+	}
+	limit := config.Limit
+	if limit <= 0 {
+		limit = DefaultLimit
+	}
+
+	now := time.Now()
+	var stale []*StaleMultipartUpload
+	files, err := up.listAllUploads(ctx, &ListMultipartConfig{Prefix: config.Prefix, Limit: limit})
+	if err != nil {
+		return nil, err
+	}
+	for _, file := range files {
+		createdAt := time.Unix(file.CreatedAt, 0)
+		if file.Completed || now.Sub(createdAt) < maxAge {
+			continue
+		}
+		stale = append(stale, &StaleMultipartUpload{
+			Path:      file.Key,
+			UploadID:  file.UUID,
+			CreatedAt: createdAt,
+			Age:       now.Sub(createdAt),
+		})
+	}
+
+	// uploads are finalized once listed, finalizing shifts the pages
+	for _, u := range stale {
+		initResult := &InitMultipartUploadResult{UploadID: u.UploadID, Path: u.Path}
+		parts, err := up.listAllParts(ctx, initResult)
+		if err == nil {
+			u.Parts = len(parts)
+			for _, part := range parts {
+				u.Bytes += part.Size
+			}
+			if config.Finalize {
+				u.Whole, err = up.isWholeUpload(ctx, u, parts)
+			}
+			if err == nil && u.Whole && !config.DryRun {
+				if err = up.CompleteMultipartUploadContext(ctx, initResult, nil); err == nil {
+					u.Finalized = true
+				}
+			}
+		}
+		if ctx.Err() != nil {
+			return stale, ctx.Err()
+		}
+		// an upload may also expire in the meantime
+		u.Err = err
+		if config.Output != nil {
+			fmt.Fprintln(config.Output, u)
+		}
+	}
+	return stale, nil
+}
+
+// isWholeUpload tells whether the server holds every part of upload u: the
+// parts are numbered from 0 without a gap and their sizes add up to the
+// length declared when the upload was initiated.
+func (up *UpYun) isWholeUpload(ctx context.Context, u *StaleMultipartUpload, parts []*MultipartUploadedPart) (bool, error) {
+	if len(parts) == 0 {
+		return false, nil
+	}
+	ids := make(map[int]bool, len(parts))
+	for _, part := range parts {
+		ids[part.Id] = true
+	}
+	for id := 0; id < len(parts); id++ {
+		if !ids[id] {
+			return false, nil
+		}
+	}
+	process, err := up.GetResumeProcessContext(ctx, u.Path)
+	if err != nil {
+		return false, err
+	}
+	return process.UploadID == u.UploadID && process.Size > 0 && process.Size == u.Bytes, nil
+}
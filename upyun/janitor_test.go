@@ -0,0 +1,64 @@
+package upyun
+
+import (
+	"bytes"
+	"path"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCleanMultipartUploads(t *testing.T) {
+	prefix := path.Join(REST_DIR, "JANITOR")
+	data := []byte(strings.Repeat("U", int(DefaultPartSize)))
+	var ids []string
+	for i, n := range []int{1, 2} {
+		result, err := up.InitMultipartUpload(&InitMultipartUploadConfig{
+			Path:          path.Join(prefix, string(rune('A'+i))),
+			PartSize:      DefaultPartSize,
+			ContentLength: 2 * DefaultPartSize,
+			OrderUpload:   true,
+		})
+		Nil(t, err)
+		for id := 0; id < n; id++ {
+			err = up.UploadPart(result, &UploadPartConfig{
+				PartID:   id,
+				PartSize: DefaultPartSize,
+				Reader:   bytes.NewReader(data),
+			})
+			Nil(t, err)
+		}
+		ids = append(ids, result.UploadID)
+	}
+
+	// the uploads are too recent
+	stale, err := up.CleanMultipartUploads(&CleanMultipartConfig{Prefix: prefix, Finalize: true})
+	Nil(t, err)
+	Equal(t, len(stale), 0)
+
+	config := &CleanMultipartConfig{Prefix: prefix, MaxAge: time.Nanosecond, Limit: 1, DryRun: true, Finalize: true}
+	stale, err = up.CleanMultipartUploads(config)
+	Nil(t, err)
+	Equal(t, len(stale), 2)
+	for _, u := range stale {
+		Equal(t, u.Finalized, false)
+		Equal(t, u.Whole, u.UploadID == ids[1])
+		Equal(t, u.Bytes, int64(u.Parts)*DefaultPartSize)
+	}
+
+	config.DryRun = false
+	stale, err = up.CleanMultipartUploads(config)
+	Nil(t, err)
+	Equal(t, len(stale), 2)
+	for _, u := range stale {
+		// only the upload of which every part was sent completes, the
+		// partial one is left alone
+		Nil(t, u.Err)
+		Equal(t, u.Whole, u.UploadID == ids[1])
+		Equal(t, u.Finalized, u.Whole)
+	}
+	_, err = up.GetInfo(path.Join(prefix, "B"))
+	Nil(t, err)
+	_, err = up.GetInfo(path.Join(prefix, "A"))
+	NotNil(t, err)
+}
@@ -0,0 +1,160 @@
+package upyun
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Mirror downloads the files of config.RemoteDir which are new or changed to
+// config.LocalDir, local files get the modification time of the remote ones.
+func (up *UpYun) Mirror(config *SyncConfig) (*SyncReport, error) {
+	return up.MirrorContext(context.Background(), config)
+}
+
+func (up *UpYun) MirrorContext(ctx context.Context, config *SyncConfig) (*SyncReport, error) {
+	plan, err := up.PlanMirrorContext(ctx, config)
+	if err != nil {
+		return nil, err
+	}
+	return up.ExecuteMirrorContext(ctx, config, plan)
+}
+
+// PlanMirror compares config.RemoteDir with config.LocalDir without changing
+// anything.
+func (up *UpYun) PlanMirror(config *SyncConfig) (*SyncPlan, error) {
+	return up.PlanMirrorContext(context.Background(), config)
+}
+
+func (up *UpYun) PlanMirrorContext(ctx context.Context, config *SyncConfig) (*SyncPlan, error) {
+	remotes, err := up.listSyncRemote(ctx, config.RemoteDir, config.Include, config.Exclude)
+	if err != nil {
+		return nil, err
+	}
+	locals := make(map[string]fs.FileInfo)
+	if _, err = os.Stat(config.LocalDir); err == nil {
+		if locals, err = listSyncLocal(config.LocalDir, config.Include, config.Exclude); err != nil {
+			return nil, err
+		}
+	} else if !os.IsNotExist(err) {
+		return nil, errorOperation("sync walk local", err)
+	}
+
+	plan := &SyncPlan{}
+	for rel, remote := range remotes {
+		item := &SyncItem{
+			Action:     SyncDownload,
+			Path:       rel,
+			LocalPath:  filepath.Join(config.LocalDir, filepath.FromSlash(rel)),
+			RemotePath: path.Join(config.RemoteDir, rel),
+			Size:       remote.Size,
+			Time:       remote.Time,
+		}
+		info, ok := locals[rel]
+		delete(locals, rel)
+		if ok {
+			item.Action = SyncOverwriteLocal
+			item.Reason, err = up.mirrorDiff(ctx, config.UseMD5, item.LocalPath, info, item.RemotePath, remote)
+			if err != nil {
+				return nil, err
+			}
+			if item.Reason == "" {
+				plan.Skipped++
+				continue
+			}
+		}
+		plan.Items = append(plan.Items, item)
+	}
+
+	if config.Delete {
+		for rel, info := range locals {
+			// left by an unfinished resume download
+			if strings.HasSuffix(rel, downloadTempSuffix) {
+				continue
+			}
+			plan.Items = append(plan.Items, &SyncItem{
+				Action:     SyncDeleteLocal,
+				Path:       rel,
+				LocalPath:  filepath.Join(config.LocalDir, filepath.FromSlash(rel)),
+				RemotePath: path.Join(config.RemoteDir, rel),
+				Size:       info.Size(),
+				Time:       info.ModTime(),
+			})
+		}
+	}
+	sortSyncPlan(plan)
+	return plan, nil
+}
+
+// mirrorDiff returns why the remote file differs from the local one, or ""
+// if they are the same. Mirrored files carry the remote modification time,
+// so any other time means the file changed on either side.
+func (up *UpYun) mirrorDiff(ctx context.Context, useMD5 bool, localPath string, info fs.FileInfo,
+	remotePath string, remote *FileInfo) (string, error) {
+	if useMD5 {
+		return up.syncDiff(ctx, true, localPath, info, remotePath, remote)
+	}
+	if info.Size() != remote.Size {
+		return "size", nil
+	}
+	if !info.ModTime().Truncate(time.Second).Equal(remote.Time.Truncate(time.Second)) {
+		return "modified", nil
+	}
+	return "", nil
+}
+
+// ExecuteMirror carries out plan, actions which fail are reported in their
+// items and counted in the returned error.
+func (up *UpYun) ExecuteMirror(config *SyncConfig, plan *SyncPlan) (*SyncReport, error) {
+	return up.ExecuteMirrorContext(context.Background(), config, plan)
+}
+
+func (up *UpYun) ExecuteMirrorContext(ctx context.Context, config *SyncConfig, plan *SyncPlan) (*SyncReport, error) {
+	return runSyncPlan(ctx, config.Concurrency, config.DryRun, config.Output, plan, func(item *SyncItem) error {
+		switch item.Action {
+		case SyncDownload, SyncOverwriteLocal:
+			return up.mirrorFile(ctx, item)
+		case SyncDeleteLocal:
+			return os.Remove(item.LocalPath)
+		}
+		return fmt.Errorf("unknown mirror action %s", item.Action)
+	})
+}
+
+// mirrorFile downloads item next to its local path and renames it into place,
+// so that a failed download never leaves a truncated file behind.
+func (up *UpYun) mirrorFile(ctx context.Context, item *SyncItem) error {
+	if err := os.MkdirAll(filepath.Dir(item.LocalPath), 0755); err != nil {
+		return err
+	}
+
+	var err error
+	if item.Size >= minResumePutFileSize {
+		_, err = up.GetContext(ctx, &GetObjectConfig{
+			Path:              item.RemotePath,
+			LocalPath:         item.LocalPath,
+			UseResumeDownload: true,
+		})
+	} else {
+		tempPath := item.LocalPath + downloadTempSuffix
+		_, err = up.GetContext(ctx, &GetObjectConfig{
+			Path:      item.RemotePath,
+			LocalPath: tempPath,
+		})
+		if err == nil {
+			err = os.Rename(tempPath, item.LocalPath)
+		}
+		if err != nil {
+			os.Remove(tempPath)
+		}
+	}
+	if err != nil {
+		return err
+	}
+	return os.Chtimes(item.LocalPath, item.Time, item.Time)
+}
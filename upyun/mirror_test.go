@@ -0,0 +1,64 @@
+package upyun
+
+import (
+	"bytes"
+	"os"
+	"path"
+	"path/filepath"
+	"testing"
+)
+
+func TestMirror(t *testing.T) {
+	localDir := TempLocalDir(t)
+	defer os.RemoveAll(localDir)
+	remoteDir := path.Join(ROOT, "MIRROR")
+
+	for name, content := range map[string]string{"a.txt": "a", "sub/b.txt": "b", "c.log": "c"} {
+		err := up.Put(&PutObjectConfig{
+			Path:   path.Join(remoteDir, name),
+			Reader: bytes.NewReader([]byte(content)),
+		})
+		Nil(t, err)
+	}
+	os.WriteFile(filepath.Join(localDir, "orphan.txt"), []byte("o"), 0644)
+
+	config := &SyncConfig{
+		LocalDir:  localDir,
+		RemoteDir: remoteDir,
+		Delete:    true,
+		Exclude:   []string{"*.log"},
+	}
+	out := &bytes.Buffer{}
+	config.DryRun, config.Output = true, out
+	report, err := up.Mirror(config)
+	Nil(t, err)
+	Equal(t, report.Count[SyncDownload], 2)
+	Equal(t, out.String(), "download a.txt\ndelete-local orphan.txt\ndownload sub/b.txt\n")
+
+	config.DryRun, config.Output = false, nil
+	report, err = up.Mirror(config)
+	Nil(t, err)
+	Equal(t, report.Count[SyncDownload], 2)
+	Equal(t, report.Count[SyncDeleteLocal], 1)
+
+	b, err := os.ReadFile(filepath.Join(localDir, "sub", "b.txt"))
+	Nil(t, err)
+	Equal(t, string(b), "b")
+	fInfo, err := up.GetInfo(path.Join(remoteDir, "sub", "b.txt"))
+	Nil(t, err)
+	stat, err := os.Stat(filepath.Join(localDir, "sub", "b.txt"))
+	Nil(t, err)
+	Equal(t, stat.ModTime().Unix(), fInfo.Time.Unix())
+	_, err = os.Stat(filepath.Join(localDir, "orphan.txt"))
+	Equal(t, os.IsNotExist(err), true)
+
+	os.WriteFile(filepath.Join(localDir, "a.txt"), []byte("aa"), 0644)
+	report, err = up.Mirror(config)
+	Nil(t, err)
+	Equal(t, report.Count[SyncOverwriteLocal], 1)
+	Equal(t, report.Skipped, 1)
+
+	for _, name := range []string{"a.txt", "sub/b.txt", "c.log"} {
+		up.Delete(&DeleteObjectConfig{Path: path.Join(remoteDir, name)})
+	}
+}
@@ -0,0 +1,217 @@
+package upyun
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	defaultNotifyWindow = 10 * time.Minute
+	maxNotifyBodySize   = 1 << 20
+)
+
+// FormNotification is the result of a form upload posted to its notify-url.
+type FormNotification struct {
+	Code      int
+	Msg       string
+	Url       string
+	Time      int64
+	ImgWidth  int
+	ImgHeight int
+	ImgFrames int
+	ImgType   string
+	ExtParam  string
+	Sign      string
+	// Values: every field of the notification
+	Values url.Values
+}
+
+// TaskNotification is the result of a processing task posted to the
+// NotifyUrl of CommitTasks.
+type TaskNotification struct {
+	StatusCode  int      `json:"status_code"`
+	Path        []string `json:"path"`
+	Description string   `json:"description"`
+	TaskId      string   `json:"task_id"`
+	Info        string   `json:"info"`
+	Signature   string   `json:"signature"`
+	Timestamp   int64    `json:"timestamp"`
+}
+
+// NotifyHandler is the http.Handler of the notify URLs, it verifies the
+// notifications and passes them to OnFormUpload or OnTask. Notifications
+// signed by the Authorization header are checked against the operator and
+// password of the UpYun, form notifications signed by the sign field as
+// VerifyReturnURL does. An error returned by a callback answers 500, so that
+// UpYun notifies again.
+type NotifyHandler struct {
+	up *UpYun
+	// Window: notifications dated further from now are rejected as replays,
+	// default 10 minutes
+	Window       time.Duration
+	OnFormUpload func(n *FormNotification) error
+	OnTask       func(n *TaskNotification) error
+}
+
+func (up *UpYun) NewNotifyHandler() *NotifyHandler {
+	return &NotifyHandler{up: up}
+}
+
+func (h *NotifyHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxNotifyBodySize))
+	if err != nil {
+		http.Error(w, "read body", http.StatusBadRequest)
+		return
+	}
+
+	values, task, err := parseNotification(r, body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	// without credentials UpYun is asked to notify again later
+	keys, err := h.up.signingKeys()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if err := h.verify(r, body, values, keys); err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	if task != nil {
+		if h.OnTask != nil {
+			err = h.OnTask(task)
+		}
+	} else if h.OnFormUpload != nil {
+		err = h.OnFormUpload(newFormNotification(values))
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// parseNotification returns the fields of a form notification, or the task
+// of a task notification.
+func parseNotification(r *http.Request, body []byte) (url.Values, *TaskNotification, error) {
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mediaType == "application/json" {
+		task := &TaskNotification{}
+		if err := json.Unmarshal(body, task); err != nil {
+			return nil, nil, fmt.Errorf("invalid notification: %v", err)
+		}
+		return nil, task, nil
+	}
+
+	values, err := url.ParseQuery(string(body))
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid notification: %v", err)
+	}
+	if values.Get("task_id") == "" {
+		return values, nil, nil
+	}
+	task := &TaskNotification{
+		Path:        values["path"],
+		Description: values.Get("description"),
+		TaskId:      values.Get("task_id"),
+		Info:        values.Get("info"),
+		Signature:   values.Get("signature"),
+	}
+	if len(task.Path) == 0 {
+		task.Path = values["path[]"]
+	}
+	task.StatusCode, _ = strconv.Atoi(values.Get("status_code"))
+	task.Timestamp, _ = strconv.ParseInt(values.Get("timestamp"), 10, 64)
+	return nil, task, nil
+}
+
+func newFormNotification(values url.Values) *FormNotification {
+	n := &FormNotification{
+		Msg:      values.Get("message"),
+		Url:      values.Get("url"),
+		ImgType:  values.Get("image-type"),
+		ExtParam: values.Get("ext-param"),
+		Sign:     values.Get("sign"),
+		Values:   values,
+	}
+	n.Code, _ = strconv.Atoi(values.Get("code"))
+	n.Time, _ = strconv.ParseInt(values.Get("time"), 10, 64)
+	n.ImgWidth, _ = strconv.Atoi(values.Get("image-width"))
+	n.ImgHeight, _ = strconv.Atoi(values.Get("image-height"))
+	n.ImgFrames, _ = strconv.Atoi(values.Get("image-frames"))
+	return n
+}
+
+// verify checks the Authorization header of r, or the sign of the form
+// notification values, and the date of the notification.
+func (h *NotifyHandler) verify(r *http.Request, body []byte, values url.Values, keys *signKeys) error {
+	window := h.Window
+	if window <= 0 {
+		window = defaultNotifyWindow
+	}
+
+	if r.Header.Get("Authorization") == "" {
+		if values == nil || values.Get("sign") == "" {
+			return errors.New("notification not signed")
+		}
+		if !verifyFormSign(keys, values) {
+			return errors.New("invalid sign")
+		}
+		t, err := strconv.ParseInt(values.Get("time"), 10, 64)
+		if err != nil {
+			return errors.New("invalid time")
+		}
+		return checkNotifyTime(time.Unix(t, 0), window)
+	}
+
+	date := r.Header.Get("Date")
+	t, err := time.Parse(http.TimeFormat, date)
+	if err != nil {
+		return errors.New("invalid date")
+	}
+	contentMD5 := r.Header.Get("Content-MD5")
+	if contentMD5 != "" && !strings.EqualFold(contentMD5, md5Str(string(body))) {
+		return errors.New("content md5 mismatch")
+	}
+	// the URI signed is the path of the notify URL, with its query if any
+	uris := []string{r.URL.EscapedPath()}
+	if r.URL.RawQuery != "" {
+		uris = append(uris, r.URL.RequestURI())
+	}
+	auth := r.Header.Get("Authorization")
+	for _, uri := range uris {
+		expect := makeUnifiedAuth(keys, &UnifiedAuthConfig{
+			Method:     r.Method,
+			Uri:        uri,
+			DateStr:    date,
+			ContentMD5: contentMD5,
+		})
+		if subtle.ConstantTimeCompare([]byte(expect), []byte(auth)) == 1 {
+			return checkNotifyTime(t, window)
+		}
+	}
+	return errors.New("invalid authorization")
+}
+
+func checkNotifyTime(t time.Time, window time.Duration) error {
+	if d := time.Since(t); d > window || d < -window {
+		return errors.New("notification out of the time window")
+	}
+	return nil
+}
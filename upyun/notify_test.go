@@ -0,0 +1,87 @@
+package upyun
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNotifyHandler(t *testing.T) {
+	notifier := NewUpYun(&UpYunConfig{Bucket: "bucket", Operator: "operator", Password: "password", Secret: "secret"})
+	handler := notifier.NewNotifyHandler()
+	var forms []*FormNotification
+	var tasks []*TaskNotification
+	handler.OnFormUpload = func(n *FormNotification) error {
+		forms = append(forms, n)
+		return nil
+	}
+	handler.OnTask = func(n *TaskNotification) error {
+		tasks = append(tasks, n)
+		if n.TaskId == "fail" {
+			return errors.New("try again")
+		}
+		return nil
+	}
+
+	post := func(uri, contentType, body string, date time.Time, sign bool) int {
+		r := httptest.NewRequest("POST", uri, strings.NewReader(body))
+		r.Header.Set("Content-Type", contentType)
+		if sign {
+			dateStr := date.UTC().Format(http.TimeFormat)
+			r.Header.Set("Date", dateStr)
+			r.Header.Set("Content-MD5", md5Str(body))
+			r.Header.Set("Authorization", notifier.MakeUnifiedAuth(&UnifiedAuthConfig{
+				Method:     "POST",
+				Uri:        r.URL.EscapedPath(),
+				DateStr:    dateStr,
+				ContentMD5: md5Str(body),
+			}))
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		return w.Code
+	}
+
+	now := time.Now()
+	task := `{"status_code":200,"path":["/a.mp4"],"task_id":"t1","timestamp":1}`
+	Equal(t, post("/notify", "application/json", task, now, true), 200)
+	Equal(t, len(tasks), 1)
+	Equal(t, tasks[0].TaskId, "t1")
+	Equal(t, tasks[0].Path, []string{"/a.mp4"})
+
+	form := url.Values{"code": {"200"}, "message": {"ok"}, "url": {"/a.jpg"}, "time": {"1"}, "image-width": {"10"}}
+	Equal(t, post("/notify?from=form", "application/x-www-form-urlencoded", form.Encode(), now, true), 200)
+	Equal(t, len(forms), 1)
+	Equal(t, forms[0].Url, "/a.jpg")
+	Equal(t, forms[0].ImgWidth, 10)
+
+	// replays and forgeries
+	Equal(t, post("/notify", "application/json", task, now.Add(-time.Hour), true), 401)
+	Equal(t, post("/notify", "application/json", task, now, false), 401)
+	r := httptest.NewRequest("POST", "/notify", strings.NewReader(task+" "))
+	r.Header.Set("Content-Type", "application/json")
+	r.Header.Set("Date", now.UTC().Format(http.TimeFormat))
+	r.Header.Set("Content-MD5", md5Str(task))
+	r.Header.Set("Authorization", "UpYun operator:forged")
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	Equal(t, w.Code, 401)
+
+	// legacy form sign
+	form.Set("time", strconv.FormatInt(now.Unix(), 10))
+	form.Set("ext-param", "x")
+	form.Set("sign", md5Str(strings.Join([]string{"200", "ok", "/a.jpg", form.Get("time"), "secret", "x"}, "&")))
+	Equal(t, post("/notify", "application/x-www-form-urlencoded", form.Encode(), now, false), 200)
+	Equal(t, len(forms), 2)
+	Equal(t, forms[1].ExtParam, "x")
+	form.Set("url", "/b.jpg")
+	Equal(t, post("/notify", "application/x-www-form-urlencoded", form.Encode(), now, false), 401)
+
+	// callback errors ask for another notification
+	Equal(t, post("/notify", "application/json", `{"task_id":"fail"}`, now, true), 500)
+}
@@ -2,13 +2,13 @@ package upyun
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
 	"path"
 	"strings"
-	"time"
 )
 
 type CommitTasksConfig struct {
@@ -37,6 +37,10 @@ type SyncCommonTask struct {
 }
 
 func (up *UpYun) CommitTasks(config *CommitTasksConfig) (taskIds []string, err error) {
+	return up.CommitTasksContext(context.Background(), config)
+}
+
+func (up *UpYun) CommitTasksContext(ctx context.Context, config *CommitTasksConfig) (taskIds []string, err error) {
 	b, err := json.Marshal(config.Tasks)
 	if err != nil {
 		return nil, err
@@ -54,16 +58,20 @@ func (up *UpYun) CommitTasks(config *CommitTasksConfig) (taskIds []string, err e
 		kwargs["accept"] = config.Accept
 	}
 
-	err = up.doProcessRequest("POST", "/pretreatment/", kwargs, &taskIds)
+	err = up.doProcessRequest(ctx, "POST", "/pretreatment/", kwargs, &taskIds)
 	return
 }
 
 func (up *UpYun) GetProgress(taskIds []string) (result map[string]int, err error) {
+	return up.GetProgressContext(context.Background(), taskIds)
+}
+
+func (up *UpYun) GetProgressContext(ctx context.Context, taskIds []string) (result map[string]int, err error) {
 	kwargs := map[string]string{
 		"task_ids": strings.Join(taskIds, ","),
 	}
 	v := map[string]map[string]int{}
-	err = up.doProcessRequest("GET", "/status/", kwargs, &v)
+	err = up.doProcessRequest(ctx, "GET", "/status/", kwargs, &v)
 	if err != nil {
 		return
 	}
@@ -75,11 +83,15 @@ func (up *UpYun) GetProgress(taskIds []string) (result map[string]int, err error
 }
 
 func (up *UpYun) GetResult(taskIds []string) (result map[string]interface{}, err error) {
+	return up.GetResultContext(context.Background(), taskIds)
+}
+
+func (up *UpYun) GetResultContext(ctx context.Context, taskIds []string) (result map[string]interface{}, err error) {
 	kwargs := map[string]string{
 		"task_ids": strings.Join(taskIds, ","),
 	}
 	v := map[string]map[string]interface{}{}
-	err = up.doProcessRequest("GET", "/result/", kwargs, &v)
+	err = up.doProcessRequest(ctx, "GET", "/result/", kwargs, &v)
 	if err != nil {
 		return
 	}
@@ -90,7 +102,7 @@ func (up *UpYun) GetResult(taskIds []string) (result map[string]interface{}, err
 	return nil, fmt.Errorf("no tasks")
 }
 
-func (up *UpYun) doProcessRequest(method, uri string,
+func (up *UpYun) doProcessRequest(ctx context.Context, method, uri string,
 	kwargs map[string]string, v interface{}) error {
 	if _, ok := kwargs["service"]; !ok {
 		kwargs["service"] = up.Bucket
@@ -101,16 +113,22 @@ func (up *UpYun) doProcessRequest(method, uri string,
 	}
 
 	headers := make(map[string]string)
-	headers["Date"] = makeRFC1123Date(time.Now())
 	headers["Content-Type"] = "application/x-www-form-urlencoded"
-	if up.deprecated {
-		headers["Authorization"] = up.MakeProcessAuth(kwargs)
-	} else {
-		headers["Authorization"] = up.MakeUnifiedAuth(&UnifiedAuthConfig{
-			Method:  method,
-			Uri:     uri,
-			DateStr: headers["Date"],
-		})
+	sign := func(headers map[string]string) error {
+		keys, err := up.signingKeys()
+		if err != nil {
+			return err
+		}
+		if up.deprecated {
+			headers["Authorization"] = makeProcessAuth(keys, kwargs)
+		} else {
+			headers["Authorization"] = makeUnifiedAuth(keys, &UnifiedAuthConfig{
+				Method:  method,
+				Uri:     uri,
+				DateStr: headers["Date"],
+			})
+		}
+		return nil
 	}
 
 	var resp *http.Response
@@ -119,10 +137,10 @@ func (up *UpYun) doProcessRequest(method, uri string,
 	rawurl := fmt.Sprintf("%s%s", endpoint, uri)
 	switch method {
 	case "GET":
-		resp, err = up.doHTTPRequest(method, rawurl, headers, nil)
+		resp, err = up.doHTTPRequest(ctx, method, rawurl, headers, nil, sign)
 	case "POST":
 		payload := encodeQueryToPayload(kwargs)
-		resp, err = up.doHTTPRequest(method, rawurl, headers, bytes.NewBufferString(payload))
+		resp, err = up.doHTTPRequest(ctx, method, rawurl, headers, bytes.NewBufferString(payload), sign)
 	default:
 		return fmt.Errorf("Unknown method")
 	}
@@ -141,6 +159,10 @@ func (up *UpYun) doProcessRequest(method, uri string,
 }
 
 func (up *UpYun) CommitSyncTasks(commitTask interface{}) (result map[string]interface{}, err error) {
+	return up.CommitSyncTasksContext(context.Background(), commitTask)
+}
+
+func (up *UpYun) CommitSyncTasksContext(ctx context.Context, commitTask interface{}) (result map[string]interface{}, err error) {
 	var kwargs map[string]interface{}
 	var uri string
 	var payload string
@@ -186,20 +208,26 @@ func (up *UpYun) CommitSyncTasks(commitTask interface{}) (result map[string]inte
 		return nil, fmt.Errorf("can't encode the json")
 	}
 	payload = string(body)
-	return up.doSyncProcessRequest("POST", uri, payload)
+	return up.doSyncProcessRequest(ctx, "POST", uri, payload)
 }
 
-func (up *UpYun) doSyncProcessRequest(method, uri string, payload string) (map[string]interface{}, error) {
+func (up *UpYun) doSyncProcessRequest(ctx context.Context, method, uri string, payload string) (map[string]interface{}, error) {
 	headers := make(map[string]string)
-	headers["Date"] = makeRFC1123Date(time.Now())
 	headers["Content-Type"] = "application/json"
 	headers["Content-MD5"] = md5Str(payload)
-	headers["Authorization"] = up.MakeUnifiedAuth(&UnifiedAuthConfig{
-		Method:     method,
-		Uri:        uri,
-		DateStr:    headers["Date"],
-		ContentMD5: headers["Content-MD5"],
-	})
+	sign := func(headers map[string]string) error {
+		keys, err := up.signingKeys()
+		if err != nil {
+			return err
+		}
+		headers["Authorization"] = makeUnifiedAuth(keys, &UnifiedAuthConfig{
+			Method:     method,
+			Uri:        uri,
+			DateStr:    headers["Date"],
+			ContentMD5: headers["Content-MD5"],
+		})
+		return nil
+	}
 
 	var resp *http.Response
 	var err error
@@ -207,7 +235,7 @@ func (up *UpYun) doSyncProcessRequest(method, uri string, payload string) (map[s
 	rawurl := fmt.Sprintf("%s%s", endpoint, uri)
 	switch method {
 	case "POST":
-		resp, err = up.doHTTPRequest(method, rawurl, headers, strings.NewReader(payload))
+		resp, err = up.doHTTPRequest(ctx, method, rawurl, headers, strings.NewReader(payload), sign)
 	default:
 		return nil, fmt.Errorf("Unknown method")
 	}
@@ -0,0 +1,185 @@
+package upyun
+
+import (
+	"context"
+	"io"
+	"sync"
+	"time"
+)
+
+const progressInterval = 100 * time.Millisecond
+
+// Progress is the state of a transfer reported to a ProgressFunc.
+type Progress struct {
+	Path string
+	// Bytes: transferred so far, bytes of a failed request are taken back
+	// before it is retried
+	Bytes int64
+	// Total: -1 if unknown
+	Total int64
+	// PartsDone and PartsTotal count the parts of resume uploads and
+	// downloads, they are 0 for transfers made by a single request
+	PartsDone  int
+	PartsTotal int
+	// Speed: bytes per second, smoothed over the recent transfer
+	Speed float64
+	// ETA: -1 if unknown
+	ETA time.Duration
+}
+
+// ProgressFunc is called as a transfer makes progress, at most every 100ms
+// and whenever a part is done. Calls never overlap, even when parts are
+// transferred concurrently.
+type ProgressFunc func(p Progress)
+
+type progressTracker struct {
+	mu         sync.Mutex
+	fn         ProgressFunc
+	p          Progress
+	lastReport time.Time
+	lastSample time.Time
+	lastBytes  int64
+}
+
+type progressKey struct{}
+
+func newProgressTracker(fn ProgressFunc, path string) *progressTracker {
+	if fn == nil {
+		return nil
+	}
+	now := time.Now()
+	return &progressTracker{
+		fn:         fn,
+		p:          Progress{Path: path, Total: -1, ETA: -1},
+		lastSample: now,
+	}
+}
+
+// withProgress makes t count the request bodies sent with ctx.
+func withProgress(ctx context.Context, t *progressTracker) context.Context {
+	if t == nil {
+		return ctx
+	}
+	return context.WithValue(ctx, progressKey{}, t)
+}
+
+func progressFromContext(ctx context.Context) *progressTracker {
+	t, _ := ctx.Value(progressKey{}).(*progressTracker)
+	return t
+}
+
+// setParts sets the total size of a transfer made by parts, of which done
+// parts with doneBytes were transferred before.
+func (t *progressTracker) setParts(total int64, parts, done int, doneBytes int64) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.p.Total, t.p.PartsTotal, t.p.PartsDone = total, parts, done
+	t.p.Bytes, t.lastBytes = doneBytes, doneBytes
+	t.report(true)
+}
+
+// setTotal sets the total size if it is not known yet.
+func (t *progressTracker) setTotal(total int64) {
+	if t == nil || total < 0 {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.p.Total < 0 {
+		t.p.Total = total
+	}
+}
+
+func (t *progressTracker) add(n int64) {
+	if t == nil || n == 0 {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.p.Bytes += n
+	t.report(n < 0 || t.p.Bytes == t.p.Total)
+}
+
+func (t *progressTracker) partDone() {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.p.PartsDone++
+	t.report(true)
+}
+
+// report calls fn with mu held, unless the last call was too recent.
+func (t *progressTracker) report(force bool) {
+	now := time.Now()
+	if dt := now.Sub(t.lastSample); dt >= progressInterval {
+		speed := float64(t.p.Bytes-t.lastBytes) / dt.Seconds()
+		if t.p.Speed == 0 {
+			t.p.Speed = speed
+		} else {
+			t.p.Speed = 0.7*t.p.Speed + 0.3*speed
+		}
+		if t.p.Speed < 0 {
+			t.p.Speed = 0
+		}
+		t.lastSample, t.lastBytes = now, t.p.Bytes
+	}
+	if !force && now.Sub(t.lastReport) < progressInterval {
+		return
+	}
+	t.lastReport = now
+
+	t.p.ETA = -1
+	if t.p.Total >= 0 && t.p.Bytes >= t.p.Total {
+		t.p.ETA = 0
+	} else if t.p.Total >= 0 && t.p.Speed > 0 {
+		t.p.ETA = time.Duration(float64(t.p.Total-t.p.Bytes) / t.p.Speed * float64(time.Second))
+	}
+	t.fn(t.p)
+}
+
+// progressReader counts the bytes read from r, which are taken back by
+// rollback if the request fails.
+type progressReader struct {
+	r io.Reader
+	t *progressTracker
+
+	mu     sync.Mutex
+	n      int64
+	closed bool
+}
+
+func (t *progressTracker) reader(r io.Reader) *progressReader {
+	return &progressReader{r: r, t: t}
+}
+
+func (pr *progressReader) Read(p []byte) (n int, err error) {
+	n, err = pr.r.Read(p)
+	pr.mu.Lock()
+	if !pr.closed {
+		pr.n += int64(n)
+		pr.t.add(int64(n))
+	}
+	pr.mu.Unlock()
+	return n, err
+}
+
+func (pr *progressReader) Close() error {
+	if c, ok := pr.r.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
+
+func (pr *progressReader) rollback() {
+	pr.mu.Lock()
+	defer pr.mu.Unlock()
+	if !pr.closed {
+		pr.closed = true
+		pr.t.add(-pr.n)
+	}
+}
@@ -0,0 +1,62 @@
+package upyun
+
+import (
+	"bytes"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestProgressTracker(t *testing.T) {
+	var reports []Progress
+	tracker := newProgressTracker(func(p Progress) {
+		reports = append(reports, p)
+	}, "/a")
+	tracker.setParts(10, 2, 0, 0)
+
+	pr := tracker.reader(strings.NewReader("hello"))
+	b := make([]byte, 5)
+	pr.Read(b)
+	pr.rollback()
+	Equal(t, tracker.p.Bytes, int64(0))
+
+	var wg sync.WaitGroup
+	for i := 0; i < 2; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			tracker.add(5)
+			tracker.partDone()
+		}()
+	}
+	wg.Wait()
+
+	last := reports[len(reports)-1]
+	Equal(t, last.Bytes, int64(10))
+	Equal(t, last.Total, int64(10))
+	Equal(t, last.PartsDone, 2)
+	Equal(t, last.ETA.Seconds(), float64(0))
+}
+
+func TestPutGetProgress(t *testing.T) {
+	key := TempKey(t)
+	var last Progress
+	err := up.Put(&PutObjectConfig{
+		Path:     key,
+		Reader:   strings.NewReader("hello world"),
+		Progress: func(p Progress) { last = p },
+	})
+	Nil(t, err)
+	Equal(t, last.Bytes, int64(11))
+	Equal(t, last.Total, int64(11))
+
+	last = Progress{}
+	_, err = up.Get(&GetObjectConfig{
+		Path:     key,
+		Writer:   &bytes.Buffer{},
+		Progress: func(p Progress) { last = p },
+	})
+	Nil(t, err)
+	Equal(t, last.Bytes, int64(11))
+	Equal(t, last.Path, key)
+}
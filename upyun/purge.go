@@ -1,33 +1,42 @@
 package upyun
 
 import (
+	"context"
 	"encoding/json"
 	"io"
 	URL "net/url"
 	"strings"
-	"time"
 )
 
 // TODO
 func (up *UpYun) Purge(urls []string) (fails []string, err error) {
+	return up.PurgeContext(context.Background(), urls)
+}
+
+func (up *UpYun) PurgeContext(ctx context.Context, urls []string) (fails []string, err error) {
 	purge := "http://purge.upyun.com/purge/"
-	date := makeRFC1123Date(time.Now())
 	purgeList := unescapeUri(strings.Join(urls, "\n"))
 
 	headers := map[string]string{
-		"Date": date,
-		"Authorization": up.MakePurgeAuth(&PurgeAuthConfig{
-			PurgeList: purgeList,
-			DateStr:   date,
-		}),
 		"Content-Type": "application/x-www-form-urlencoded;charset=utf-8",
 	}
+	sign := func(headers map[string]string) error {
+		keys, err := up.signingKeys()
+		if err != nil {
+			return err
+		}
+		headers["Authorization"] = makePurgeAuth(keys, up.Bucket, &PurgeAuthConfig{
+			PurgeList: purgeList,
+			DateStr:   headers["Date"],
+		})
+		return nil
+	}
 
 	form := make(URL.Values)
 	form.Add("purge", purgeList)
 
 	body := strings.NewReader(form.Encode())
-	resp, err := up.doHTTPRequest("POST", purge, headers, body)
+	resp, err := up.doHTTPRequest(ctx, "POST", purge, headers, body, sign)
 	if err != nil {
 		return fails, errorOperation("purge", err)
 	}
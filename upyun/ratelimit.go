@@ -0,0 +1,132 @@
+package upyun
+
+import (
+	"context"
+	"io"
+	"sync"
+	"time"
+)
+
+// RateLimiter is a token bucket which limits bytes or requests per second.
+// One limiter may be shared by several UpYun to enforce a common budget, its
+// rate can be changed at any time by SetRate.
+type RateLimiter struct {
+	mu     sync.Mutex
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+// NewRateLimiter returns a limiter allowing rate tokens per second with
+// bursts of burst tokens, burst defaults to one second worth of tokens.
+// A rate <= 0 means no limit.
+func NewRateLimiter(rate float64, burst int) *RateLimiter {
+	l := &RateLimiter{}
+	l.SetRate(rate, burst)
+	l.tokens = l.burst
+	return l
+}
+
+// SetRate changes the limit, waits already started are not shortened.
+func (l *RateLimiter) SetRate(rate float64, burst int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.refill(time.Now())
+	l.rate = rate
+	l.burst = float64(burst)
+	if l.burst <= 0 {
+		l.burst = rate
+	}
+	if l.tokens > l.burst {
+		l.tokens = l.burst
+	}
+}
+
+// Rate returns the tokens allowed per second, <= 0 if unlimited.
+func (l *RateLimiter) Rate() float64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.rate
+}
+
+func (l *RateLimiter) refill(now time.Time) {
+	if !l.last.IsZero() && l.rate > 0 {
+		l.tokens += now.Sub(l.last).Seconds() * l.rate
+		if l.tokens > l.burst {
+			l.tokens = l.burst
+		}
+	}
+	l.last = now
+}
+
+// reserve takes n tokens and returns how long to wait until they are
+// available. More tokens than burst are taken on credit.
+func (l *RateLimiter) reserve(n int) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.rate <= 0 {
+		return 0
+	}
+	l.refill(time.Now())
+	l.tokens -= float64(n)
+	if l.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-l.tokens / l.rate * float64(time.Second))
+}
+
+// unreserve gives back n tokens reserved but not used.
+func (l *RateLimiter) unreserve(n int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.rate <= 0 {
+		return
+	}
+	l.refill(time.Now())
+	l.tokens += float64(n)
+	if l.tokens > l.burst {
+		l.tokens = l.burst
+	}
+}
+
+// WaitN blocks until n tokens are available or ctx is done, in which case
+// the tokens are given back.
+func (l *RateLimiter) WaitN(ctx context.Context, n int) error {
+	if l == nil || n <= 0 {
+		return nil
+	}
+	if d := l.reserve(n); d > 0 {
+		if err := sleepContext(ctx, d); err != nil {
+			l.unreserve(n)
+			return err
+		}
+	}
+	return nil
+}
+
+// rateLimitedReader waits for the limiter after every read from r.
+type rateLimitedReader struct {
+	ctx context.Context
+	r   io.Reader
+	l   *RateLimiter
+}
+
+func (r *rateLimitedReader) Read(p []byte) (int, error) {
+	// small reads keep the flow smooth
+	if len(p) > defaultChunkSize {
+		p = p[:defaultChunkSize]
+	}
+	n, err := r.r.Read(p)
+	if werr := r.l.WaitN(r.ctx, n); werr != nil && err == nil {
+		err = werr
+	}
+	return n, err
+}
+
+func (r *rateLimitedReader) Close() error {
+	if c, ok := r.r.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
@@ -0,0 +1,35 @@
+package upyun
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestRateLimiter(t *testing.T) {
+	l := NewRateLimiter(100, 10)
+	ctx := context.Background()
+
+	start := time.Now()
+	Nil(t, l.WaitN(ctx, 10))
+	Equal(t, time.Since(start) < 50*time.Millisecond, true)
+	Nil(t, l.WaitN(ctx, 10))
+	Equal(t, time.Since(start) >= 80*time.Millisecond, true)
+
+	canceled, cancel := context.WithCancel(ctx)
+	cancel()
+	NotNil(t, l.WaitN(canceled, 1000))
+	// the canceled wait gives its tokens back
+	start = time.Now()
+	Nil(t, l.WaitN(ctx, 1))
+	Equal(t, time.Since(start) < 50*time.Millisecond, true)
+
+	l.SetRate(0, 0)
+	start = time.Now()
+	Nil(t, l.WaitN(ctx, 1000000))
+	Equal(t, time.Since(start) < 50*time.Millisecond, true)
+	Equal(t, l.Rate(), float64(0))
+
+	var unlimited *RateLimiter
+	Nil(t, unlimited.WaitN(ctx, 1))
+}
@@ -0,0 +1,180 @@
+package upyun
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"sync"
+)
+
+const defaultReadAheadSize = 1024 * 1024
+
+// ObjectReader reads an object at random positions with HTTP Range
+// requests, fetched lazily when data is needed. Sequential reads fetch
+// ReadAhead bytes at once.
+type ObjectReader struct {
+	up   *UpYun
+	ctx  context.Context
+	path string
+	info *FileInfo
+
+	offset    int64
+	readAhead int64
+
+	mu     sync.Mutex
+	buf    []byte
+	bufOff int64
+	closed bool
+}
+
+// Open returns a reader of the object at path.
+func (up *UpYun) Open(path string) (*ObjectReader, error) {
+	return up.OpenContext(context.Background(), path)
+}
+
+func (up *UpYun) OpenContext(ctx context.Context, path string) (*ObjectReader, error) {
+	fInfo, err := up.GetInfoContext(ctx, path)
+	if err != nil {
+		return nil, errorOperation(fmt.Sprintf("open %s", path), err)
+	}
+	if fInfo.IsDir {
+		return nil, fmt.Errorf("open %s: is a directory", path)
+	}
+	return up.newObjectReader(ctx, path, fInfo), nil
+}
+
+func (up *UpYun) newObjectReader(ctx context.Context, path string, fInfo *FileInfo) *ObjectReader {
+	return &ObjectReader{
+		up:        up,
+		ctx:       ctx,
+		path:      path,
+		info:      fInfo,
+		readAhead: defaultReadAheadSize,
+	}
+}
+
+// SetReadAhead sets the minimum number of bytes fetched by one request,
+// 0 fetches only what is asked for.
+func (r *ObjectReader) SetReadAhead(n int64) {
+	r.mu.Lock()
+	r.readAhead = n
+	r.mu.Unlock()
+}
+
+// Stat returns the information of the object got by Open.
+func (r *ObjectReader) Stat() *FileInfo {
+	return r.info
+}
+
+func (r *ObjectReader) Size() int64 {
+	return r.info.Size
+}
+
+func (r *ObjectReader) Read(p []byte) (n int, err error) {
+	n, err = r.ReadAt(p, r.offset)
+	r.offset += int64(n)
+	return n, err
+}
+
+func (r *ObjectReader) ReadAt(p []byte, off int64) (n int, err error) {
+	if off < 0 {
+		return 0, errors.New("upyun: negative offset")
+	}
+
+	r.mu.Lock()
+	if r.closed {
+		r.mu.Unlock()
+		return 0, fs.ErrClosed
+	}
+	readAhead := r.readAhead
+	// served from the read-ahead buffer
+	if off >= r.bufOff && off < r.bufOff+int64(len(r.buf)) {
+		n = copy(p, r.buf[off-r.bufOff:])
+	}
+	r.mu.Unlock()
+
+	size := r.info.Size
+	for n < len(p) {
+		pos := off + int64(n)
+		if pos >= size {
+			return n, io.EOF
+		}
+		length := int64(len(p) - n)
+		if length < readAhead {
+			length = readAhead
+		}
+		if pos+length > size {
+			length = size - pos
+		}
+		b, err := r.fetch(pos, length)
+		if err != nil {
+			return n, err
+		}
+		n += copy(p[n:], b)
+
+		r.mu.Lock()
+		r.buf, r.bufOff = b, pos
+		r.mu.Unlock()
+	}
+	return n, nil
+}
+
+// fetch gets length bytes of the object from off.
+func (r *ObjectReader) fetch(off, length int64) ([]byte, error) {
+	resp, err := r.up.doRESTRequest(r.ctx, &restReqConfig{
+		method: "GET",
+		uri:    r.path,
+		headers: map[string]string{
+			"Range":          fmt.Sprintf("bytes=%d-%d", off, off+length-1),
+			"x-upyun-folder": "false",
+		},
+	})
+	if err != nil {
+		return nil, errorOperation(fmt.Sprintf("get %s", r.path), err)
+	}
+	defer resp.Body.Close()
+
+	body := io.Reader(resp.Body)
+	// the whole object is sent when the range is ignored
+	if resp.StatusCode != http.StatusPartialContent && off > 0 {
+		if _, err = io.CopyN(io.Discard, body, off); err != nil {
+			return nil, errorOperation("read body", err)
+		}
+	}
+	b := make([]byte, length)
+	if _, err = io.ReadFull(body, b); err != nil {
+		return nil, errorOperation("read body", err)
+	}
+	return b, nil
+}
+
+func (r *ObjectReader) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += r.offset
+	case io.SeekEnd:
+		offset += r.info.Size
+	default:
+		return 0, errors.New("upyun: invalid whence")
+	}
+	if offset < 0 {
+		return 0, errors.New("upyun: negative position")
+	}
+	r.offset = offset
+	return offset, nil
+}
+
+func (r *ObjectReader) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.closed {
+		return fs.ErrClosed
+	}
+	r.closed = true
+	r.buf = nil
+	return nil
+}
@@ -0,0 +1,48 @@
+package upyun
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"path"
+	"testing"
+)
+
+func TestObjectReader(t *testing.T) {
+	data := []byte(BUF_CONTENT)
+	key := path.Join(ROOT, "READER", "FILE")
+	err := up.Put(&PutObjectConfig{
+		Path:   key,
+		Reader: bytes.NewReader(data),
+		Headers: map[string]string{
+			"Content-Length": fmt.Sprint(len(data)),
+		},
+	})
+	Nil(t, err)
+
+	r, err := up.Open(key)
+	Nil(t, err)
+	Equal(t, r.Size(), int64(len(data)))
+
+	p := make([]byte, 4)
+	n, err := r.ReadAt(p, 6)
+	Nil(t, err)
+	Equal(t, string(p[:n]), string(data[6:10]))
+
+	_, err = r.Seek(-3, io.SeekEnd)
+	Nil(t, err)
+	b, err := io.ReadAll(r)
+	Nil(t, err)
+	Equal(t, string(b), string(data[len(data)-3:]))
+
+	r.SetReadAhead(0)
+	_, err = r.Seek(0, io.SeekStart)
+	Nil(t, err)
+	b, err = io.ReadAll(r)
+	Nil(t, err)
+	Equal(t, string(b), string(data))
+	Nil(t, r.Close())
+
+	err = up.Delete(&DeleteObjectConfig{Path: key})
+	Nil(t, err)
+}
@@ -15,10 +15,42 @@ type Recorder interface {
 	TimedClearance()
 }
 
+// DownloadRecorder keeps the progress of resume downloads by local path.
+type DownloadRecorder interface {
+	Set(localPath string, point *DownloadPointConfig)
+
+	Get(localPath string) *DownloadPointConfig
+
+	Delete(localPath string)
+
+	TimedClearance()
+}
+
+// ExpiringRecorder is implemented by the recorders whose records expire
+// after TTL instead of 24h. TimedClearance is then called every TTL.
+type ExpiringRecorder interface {
+	TTL() time.Duration
+}
+
+// recordTTL returns the TTL of the records of recorder.
+func recordTTL(recorder interface{}) time.Duration {
+	if r, ok := recorder.(ExpiringRecorder); ok && r.TTL() > 0 {
+		return r.TTL()
+	}
+	return defaultRecordTTL
+}
+
 type MemoryRecorder struct {
+	// RecordTTL: records not updated within it expire, default 24h
+	RecordTTL time.Duration
+
 	resumeRecorder sync.Map
 }
 
+func (recorder *MemoryRecorder) TTL() time.Duration {
+	return recorder.RecordTTL
+}
+
 func (recorder *MemoryRecorder) Get(path string) *BreakPointConfig {
 	if value, ok := recorder.resumeRecorder.Load(path); ok {
 		if breakPoint, ok := value.(*BreakPointConfig); ok {
@@ -42,10 +74,50 @@ func (recorder *MemoryRecorder) TimedClearance() {
 		if !ok {
 			return false
 		}
-		// breakPoint survival time was more than 24h
-		if breakPoint.LastTime.Add(24 * time.Hour).Before(time.Now()) {
+		if breakPoint.LastTime.Add(recordTTL(recorder)).Before(time.Now()) {
 			recorder.resumeRecorder.Delete(key)
 		}
 		return true
 	})
 }
+
+type MemoryDownloadRecorder struct {
+	// RecordTTL: records not updated within it expire, default 24h
+	RecordTTL time.Duration
+
+	downloadRecorder sync.Map
+}
+
+func (recorder *MemoryDownloadRecorder) TTL() time.Duration {
+	return recorder.RecordTTL
+}
+
+func (recorder *MemoryDownloadRecorder) Get(localPath string) *DownloadPointConfig {
+	if value, ok := recorder.downloadRecorder.Load(localPath); ok {
+		if point, ok := value.(*DownloadPointConfig); ok {
+			return point
+		}
+	}
+	return nil
+}
+
+func (recorder *MemoryDownloadRecorder) Set(localPath string, point *DownloadPointConfig) {
+	recorder.downloadRecorder.Store(localPath, point)
+}
+
+func (recorder *MemoryDownloadRecorder) Delete(localPath string) {
+	recorder.downloadRecorder.Delete(localPath)
+}
+
+func (recorder *MemoryDownloadRecorder) TimedClearance() {
+	recorder.downloadRecorder.Range(func(key, value interface{}) bool {
+		point, ok := value.(*DownloadPointConfig)
+		if !ok {
+			return false
+		}
+		if point.LastTime.Add(recordTTL(recorder)).Before(time.Now()) {
+			recorder.downloadRecorder.Delete(key)
+		}
+		return true
+	})
+}
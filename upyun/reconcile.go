@@ -0,0 +1,246 @@
+package upyun
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+)
+
+// resumeState is an unfinished multipart upload and the parts of it which
+// the server holds.
+type resumeState struct {
+	uploadID string
+	partSize int64
+	done     map[int]bool
+}
+
+// nextPart returns the first part missing from an ordered upload.
+func (s *resumeState) nextPart() int {
+	id := 0
+	for s.done[id] {
+		id++
+	}
+	return id
+}
+
+// uploadCandidate is an upload which may be resumed. Trusted candidates are
+// known to be uploads of the same content, parts of the others must match by
+// etag. The part size of candidates found on the server is told by their
+// parts.
+type uploadCandidate struct {
+	uploadID string
+	partSize int64
+	trusted  bool
+}
+
+// reconcileUpload looks for an unfinished upload of r to config.Path: the
+// recorded breakpoint, the latest upload reported by GetResumeProcess and the
+// uploads listed by ListMultipartUploads, in that order. The parts of each
+// candidate are listed by ListMultipartParts, so that parts the server holds
+// are not sent again and an expired upload id is skipped. It returns nil if
+// there is nothing to resume.
+func (up *UpYun) reconcileUpload(ctx context.Context, config *PutObjectConfig, r io.ReaderAt,
+	fileinfo os.FileInfo, breakpoint *BreakPointConfig, order bool) (*resumeState, error) {
+	fsize := fileinfo.Size()
+	tried := make(map[string]bool)
+	try := func(c *uploadCandidate) (*resumeState, error) {
+		if c.uploadID == "" || tried[c.uploadID] {
+			return nil, nil
+		}
+		tried[c.uploadID] = true
+		done, err := up.verifiedParts(ctx, config.Path, c, r, fsize)
+		if err != nil || c.partSize <= 0 || (len(done) == 0 && !c.trusted) {
+			return nil, err
+		}
+		return &resumeState{uploadID: c.uploadID, partSize: c.partSize, done: done}, nil
+	}
+
+	if breakpoint != nil {
+		state, err := try(&uploadCandidate{
+			uploadID: breakpoint.UploadID,
+			partSize: breakpoint.PartSize,
+			trusted:  true,
+		})
+		if err != nil && ctx.Err() == nil {
+			// the parts cannot be listed, trust the record
+			state = &resumeState{
+				uploadID: breakpoint.UploadID,
+				partSize: breakpoint.PartSize,
+				done:     make(map[int]bool),
+			}
+			for id := 0; id < breakpoint.PartID; id++ {
+				state.done[id] = true
+			}
+			return state, nil
+		}
+		if state != nil || err != nil {
+			return state, err
+		}
+	}
+
+	process, _ := up.GetResumeProcessContext(ctx, config.Path)
+	if process != nil && process.Order == order && process.Size == fsize {
+		state, err := try(&uploadCandidate{
+			uploadID: process.UploadID,
+			// readers other than files have no modification time to validate against
+			trusted: !fileinfo.ModTime().IsZero() && fileinfo.ModTime().Unix() <= process.CreateTime.Unix(),
+		})
+		if state != nil || err != nil {
+			return state, err
+		}
+	}
+
+	// the mode of listed uploads is unknown, parts of a disorder upload can
+	// be sent in order but not the other way round
+	if !order {
+		return nil, nil
+	}
+	files, err := up.listAllUploads(ctx, &ListMultipartConfig{Prefix: config.Path})
+	if err != nil {
+		return nil, nil
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].CreatedAt > files[j].CreatedAt })
+	for _, file := range files {
+		if file.Completed || strings.TrimPrefix(file.Key, "/") != strings.TrimPrefix(config.Path, "/") {
+			continue
+		}
+		state, err := try(&uploadCandidate{uploadID: file.UUID})
+		if state != nil || err != nil {
+			return state, err
+		}
+	}
+	return nil, nil
+}
+
+// verifiedParts returns the ids of the parts of upload c which the server
+// holds with the size of the same part of r, and its etag unless c is
+// trusted. An upload the server no longer knows has no parts and is not
+// trusted.
+func (up *UpYun) verifiedParts(ctx context.Context, path string, c *uploadCandidate,
+	r io.ReaderAt, fsize int64) (map[int]bool, error) {
+	parts, err := up.listAllParts(ctx, &InitMultipartUploadResult{UploadID: c.uploadID, Path: path})
+	if err != nil {
+		if e, ok := err.(*Error); ok && e.StatusCode >= 400 && e.StatusCode < 500 && e.StatusCode != http.StatusTooManyRequests {
+			// expired or unknown upload id
+			c.trusted = false
+			return nil, nil
+		}
+		return nil, err
+	}
+	if c.partSize <= 0 {
+		var sure bool
+		if c.partSize, sure = uploadPartSize(parts); !sure {
+			c.trusted = false
+		}
+		if c.partSize <= 0 {
+			return nil, nil
+		}
+	}
+
+	partNum := int((fsize + c.partSize - 1) / c.partSize)
+	done := make(map[int]bool, len(parts))
+	for _, part := range parts {
+		if part.Id < 0 || part.Id >= partNum {
+			continue
+		}
+		offset := int64(part.Id) * c.partSize
+		size := c.partSize
+		if fsize-offset < size {
+			size = fsize - offset
+		}
+		if part.Size != size {
+			continue
+		}
+		if c.trusted {
+			done[part.Id] = true
+			continue
+		}
+		etag := strings.ToLower(strings.Trim(part.Etag, "\""))
+		if etag == "" {
+			continue
+		}
+		sum, err := md5File(io.NewSectionReader(r, offset, size))
+		if err != nil {
+			return nil, err
+		}
+		if sum == etag {
+			done[part.Id] = true
+		}
+	}
+	return done, nil
+}
+
+// uploadPartSize returns the part size of an upload from its parts: the size
+// of the parts but the last one, which may be shorter. A single part may be
+// the last one, its size is then only a guess.
+func uploadPartSize(parts []*MultipartUploadedPart) (size int64, sure bool) {
+	last := -1
+	for _, part := range parts {
+		if part.Id > last {
+			last = part.Id
+		}
+	}
+	for _, part := range parts {
+		if part.Id == last {
+			continue
+		}
+		if size != 0 && part.Size != size {
+			return 0, false
+		}
+		size = part.Size
+	}
+	if size > 0 {
+		return size, true
+	}
+	if len(parts) == 1 && parts[0].Size > 0 && parts[0].Size%DefaultPartSize == 0 {
+		return parts[0].Size, false
+	}
+	return 0, false
+}
+
+// listAllUploads pages through ListMultipartUploads from config.Iter.
+func (up *UpYun) listAllUploads(ctx context.Context, config *ListMultipartConfig) ([]*MultipartUploadFile, error) {
+	var files []*MultipartUploadFile
+	for {
+		result, err := up.ListMultipartUploadsContext(ctx, config)
+		if err != nil {
+			return files, err
+		}
+		files = append(files, result.Files...)
+		// servers without paging return everything at once
+		if len(result.Files) == 0 || result.Iter == "" || result.Iter == listEndIter ||
+			result.Iter == config.Iter {
+			return files, nil
+		}
+		config.Iter = result.Iter
+	}
+}
+
+// listAllParts pages through ListMultipartParts.
+func (up *UpYun) listAllParts(ctx context.Context, initResult *InitMultipartUploadResult) ([]*MultipartUploadedPart, error) {
+	var parts []*MultipartUploadedPart
+	begin := 0
+	for {
+		result, err := up.ListMultipartPartsContext(ctx, initResult, &ListMultipartPartsConfig{BeginID: begin})
+		if err != nil {
+			return nil, err
+		}
+		next := begin
+		for _, part := range result.Parts {
+			if part.Id >= begin {
+				parts = append(parts, part)
+				if part.Id >= next {
+					next = part.Id + 1
+				}
+			}
+		}
+		// no page or a page the server did not start at begin
+		if next == begin {
+			return parts, nil
+		}
+		begin = next
+	}
+}
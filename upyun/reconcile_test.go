@@ -0,0 +1,65 @@
+package upyun
+
+import (
+	"bytes"
+	"context"
+	"path"
+	"strings"
+	"testing"
+)
+
+func TestReconcileUpload(t *testing.T) {
+	data := []byte(strings.Repeat("U", minResumePutFileSize+100))
+	r := bytes.NewReader(data)
+	info := readerAtInfo{size: int64(len(data))}
+	config := &PutObjectConfig{
+		Path:           path.Join(REST_DIR, "FILE_RECONCILE"),
+		ResumePartSize: DefaultPartSize,
+	}
+
+	result, err := up.InitMultipartUpload(&InitMultipartUploadConfig{
+		Path:          config.Path,
+		PartSize:      DefaultPartSize,
+		ContentLength: info.size,
+		OrderUpload:   true,
+	})
+	Nil(t, err)
+	for id := 0; id < 2; id++ {
+		err = up.UploadPart(result, &UploadPartConfig{
+			PartID:   id,
+			PartSize: DefaultPartSize,
+			Reader:   bytes.NewReader(data[int64(id)*DefaultPartSize : int64(id+1)*DefaultPartSize]),
+		})
+		Nil(t, err)
+	}
+
+	// the parts held by the server are found without a breakpoint, and
+	// instead of an expired one
+	for _, breakpoint := range []*BreakPointConfig{
+		nil,
+		{UploadID: "expired", PartSize: DefaultPartSize, PartID: 3},
+	} {
+		state, err := up.reconcileUpload(context.Background(), config, r, info, breakpoint, true)
+		Nil(t, err)
+		NotNil(t, state)
+		Equal(t, state.uploadID, result.UploadID)
+		Equal(t, state.nextPart(), 2)
+	}
+
+	// parts of other content are not resumed
+	other := bytes.NewReader(bytes.Repeat([]byte("P"), len(data)))
+	state, err := up.reconcileUpload(context.Background(), config, other, info, nil, true)
+	Nil(t, err)
+	Equal(t, state, (*resumeState)(nil))
+
+	err = up.resumePut(context.Background(), &PutObjectConfig{
+		Path:           config.Path,
+		Reader:         bytes.NewReader(data),
+		UseMD5:         true,
+		ResumePartSize: DefaultPartSize,
+	})
+	Nil(t, err)
+	fileInfo, err := up.GetInfo(config.Path)
+	Nil(t, err)
+	Equal(t, fileInfo.MD5, md5Str(string(data)))
+}
@@ -1,18 +1,19 @@
 package upyun
 
 import (
+	"context"
 	"encoding/base64"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
 	"io/fs"
-	"net"
 	"net/http"
 	"os"
 	"path"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 )
 
@@ -23,6 +24,9 @@ const (
 	MaxListTries         = 5
 	MaxLimit             = 4096
 	DefaultLimit         = 256
+
+	// listEndIter is the iter of the last page of a listing
+	listEndIter = "g2gCZAAEbmV4dGQAA2VvZg"
 )
 
 type restReqConfig struct {
@@ -42,6 +46,15 @@ type GetObjectConfig struct {
 	Headers   map[string]string
 	LocalPath string
 	Writer    io.Writer
+	// UseResumeDownload: download LocalPath by concurrent ranges through a
+	// temporary file, which is resumed after a failure
+	UseResumeDownload bool
+	ResumePartSize    int64
+	ResumeConcurrency int
+	// MaxResumeGetTries: attempts of a part, 0 for no limit, retried with
+	// the delays of UpYun.RetryPolicy, exponential backoff if it is nil
+	MaxResumeGetTries int
+	Progress          ProgressFunc
 }
 
 // GetObjectConfig provides a configuration to List method.
@@ -51,7 +64,8 @@ type GetObjectsConfig struct {
 	ObjectsChan    chan *FileInfo
 	QuitChan       chan bool
 	MaxListObjects int
-	MaxListTries   int
+	// Deprecated: failed requests are retried by UpYun.RetryPolicy
+	MaxListTries int
 	// MaxListLevel: depth of recursion
 	MaxListLevel int
 	// DescOrder:  whether list objects by desc-order
@@ -60,7 +74,6 @@ type GetObjectsConfig struct {
 	rootDir string
 	level   int
 	objNum  int
-	try     int
 }
 
 // ListObjectsConfig list objects Config
@@ -68,7 +81,7 @@ type ListObjectsConfig struct {
 	Path         string            // 文件路径or文件夹路径
 	Headers      map[string]string // 请求头
 	Iter         string            // 下次遍历目录的开始位置，第一次不需要输入，之后每次返回结果时会返回当前结束的位置, 即下次开始的位置
-	MaxListTries int               // 重试的次数最大值
+	MaxListTries int               // Deprecated: 失败的请求由 UpYun.RetryPolicy 重试
 	DescOrder    bool              // 正序or倒叙, 默认正序
 	Limit        int               // 每次遍历的文件个数，默认256 最大值为4096
 }
@@ -78,21 +91,37 @@ type GetRequestConfig struct {
 	Headers map[string]string
 }
 
+// ProxyReader wraps the reader of an upload, in resume upload it is called
+// for every part with the offset of the part.
 type ProxyReader func(offset int64, r io.Reader) io.Reader
 
 // PutObjectConfig provides a configuration to Put method.
 type PutObjectConfig struct {
-	Path            string
-	LocalPath       string
+	Path      string
+	LocalPath string
+	// Reader must be an *os.File or an io.ReaderAt for resume upload.
 	Reader          io.Reader
 	Headers         map[string]string
 	UseMD5          bool
 	UseResumeUpload bool
 	// Append Api Deprecated
 	// AppendContent     bool
-	ResumePartSize    int64
+	ResumePartSize int64
+	// MaxResumePutTries: attempts of a part, 0 for no limit, retried with
+	// the delays of UpYun.RetryPolicy, exponential backoff if it is nil
 	MaxResumePutTries int
-	ProxyReader       ProxyReader
+	// ResumeConcurrency: number of parts uploaded at the same time in
+	// resume upload, more than 1 switches to the disorder upload mode
+	ResumeConcurrency int
+	// ContentLength: size of Reader in resume upload, optional for *os.File
+	// and readers with a Size() method
+	ContentLength int64
+	// Fingerprint identifies the content of Reader in resume upload, it is
+	// checked instead of the modification time before resuming a breakpoint.
+	// Breakpoints of non-file readers without fingerprint are never resumed.
+	Fingerprint string
+	ProxyReader ProxyReader
+	Progress    ProgressFunc
 }
 
 type MoveObjectConfig struct {
@@ -144,6 +173,8 @@ type ModifyMetadataConfig struct {
 type ListMultipartConfig struct {
 	Prefix string
 	Limit  int64
+	// Iter: the Iter of the previous page, empty for the first one
+	Iter string
 }
 type ListMultipartPartsConfig struct {
 	BeginID int
@@ -156,6 +187,9 @@ type MultipartUploadFile struct {
 }
 type ListMultipartUploadResult struct {
 	Files []*MultipartUploadFile `json:"files"`
+	// Iter: the position of the next page, empty or the end marker after
+	// the last one
+	Iter string `json:"iter"`
 }
 type MultipartUploadedPart struct {
 	Etag string `json:"etag"`
@@ -167,8 +201,12 @@ type ListUploadedPartsResult struct {
 }
 
 func (up *UpYun) Usage() (n int64, err error) {
+	return up.UsageContext(context.Background())
+}
+
+func (up *UpYun) UsageContext(ctx context.Context) (n int64, err error) {
 	var resp *http.Response
-	resp, err = up.doRESTRequest(&restReqConfig{
+	resp, err = up.doRESTRequest(ctx, &restReqConfig{
 		method: "GET",
 		uri:    "/",
 		query:  "usage",
@@ -185,7 +223,11 @@ func (up *UpYun) Usage() (n int64, err error) {
 }
 
 func (up *UpYun) Mkdir(path string) error {
-	_, err := up.doRESTRequest(&restReqConfig{
+	return up.MkdirContext(context.Background(), path)
+}
+
+func (up *UpYun) MkdirContext(ctx context.Context, path string) error {
+	_, err := up.doRESTRequest(ctx, &restReqConfig{
 		method: "POST",
 		uri:    path,
 		headers: map[string]string{
@@ -201,6 +243,15 @@ func (up *UpYun) Mkdir(path string) error {
 }
 
 func (up *UpYun) Get(config *GetObjectConfig) (fInfo *FileInfo, err error) {
+	return up.GetContext(context.Background(), config)
+}
+
+func (up *UpYun) GetContext(ctx context.Context, config *GetObjectConfig) (fInfo *FileInfo, err error) {
+	progress := newProgressTracker(config.Progress, config.Path)
+	ctx = withProgress(ctx, progress)
+	if config.UseResumeDownload {
+		return up.resumeGet(ctx, config)
+	}
 	if config.LocalPath != "" {
 		var fd *os.File
 		if fd, err = os.Create(config.LocalPath); err != nil {
@@ -220,7 +271,7 @@ func (up *UpYun) Get(config *GetObjectConfig) (fInfo *FileInfo, err error) {
 		return nil, errors.New("no writer")
 	}
 
-	resp, err := up.doRESTRequest(&restReqConfig{
+	resp, err := up.doRESTRequest(ctx, &restReqConfig{
 		method:  "GET",
 		uri:     config.Path,
 		headers: config.Headers,
@@ -233,13 +284,18 @@ func (up *UpYun) Get(config *GetObjectConfig) (fInfo *FileInfo, err error) {
 	fInfo = parseHeaderToFileInfo(resp.Header, false)
 	fInfo.Name = config.Path
 
-	if fInfo.Size, err = io.Copy(config.Writer, resp.Body); err != nil {
+	body := io.Reader(resp.Body)
+	if progress != nil {
+		progress.setTotal(resp.ContentLength)
+		body = progress.reader(body)
+	}
+	if fInfo.Size, err = io.Copy(config.Writer, body); err != nil {
 		return nil, errorOperation("io copy", err)
 	}
 	return
 }
 
-func (up *UpYun) put(config *PutObjectConfig) error {
+func (up *UpYun) put(ctx context.Context, config *PutObjectConfig) error {
 	/* Append Api Deprecated
 	if config.AppendContent {
 		if config.Headers == nil {
@@ -253,7 +309,7 @@ func (up *UpYun) put(config *PutObjectConfig) error {
 	if config.ProxyReader != nil {
 		reader = config.ProxyReader(0, config.Reader)
 	}
-	_, err := up.doRESTRequest(&restReqConfig{
+	_, err := up.doRESTRequest(ctx, &restReqConfig{
 		method:    "PUT",
 		uri:       config.Path,
 		headers:   config.Headers,
@@ -285,85 +341,134 @@ func getPartInfo(partSize, fsize int64) (int64, int64, error) {
 	return partSize, partNum, nil
 }
 
-func (up *UpYun) getMultipartUploadProcess(config *PutObjectConfig, fileinfo os.FileInfo) (*ResumeProcessResult, error) {
-	resumeProcessResult, _ := up.GetResumeProcess(config.Path)
-	if resumeProcessResult != nil && resumeProcessResult.Order {
-		if fileinfo.Size() == resumeProcessResult.Size && fileinfo.ModTime().Unix() <= resumeProcessResult.CreateTime.Unix() {
-			// fmt.Printf("continue process: %s next: %d\n", config.Path, resumeProcessResult.NextPartID)
-			return resumeProcessResult, nil
+// getResumeState returns the upload to continue, reconciled with the server,
+// or a new one. The returned breakpoint is recorded.
+func (up *UpYun) getResumeState(ctx context.Context, config *PutObjectConfig, r io.ReaderAt,
+	fileinfo os.FileInfo, order bool) (*BreakPointConfig, *resumeState, error) {
+	var breakpoint *BreakPointConfig
+	if up.Recorder != nil {
+		breakpoint = up.Recorder.Get(config.Path)
+	}
+	// first upload or file has expired
+	if breakpoint != nil && (breakpoint.Disorder == order || isRecordExpired(fileinfo, breakpoint, config.Fingerprint, recordTTL(up.Recorder))) {
+		breakpoint = nil
+	}
+
+	state, err := up.reconcileUpload(ctx, config, r, fileinfo, breakpoint, order)
+	if err != nil {
+		return nil, nil, err
+	}
+	if state == nil {
+		initMultipartUploadConfig := &InitMultipartUploadConfig{
+			Path:          config.Path,
+			ContentLength: fileinfo.Size(),
+			PartSize:      config.ResumePartSize,
+			ContentType:   config.Headers["Content-Type"],
+			OrderUpload:   order,
+		}
+		initMultipartUploadResult, err := up.InitMultipartUploadContext(ctx, initMultipartUploadConfig)
+		if err != nil {
+			return nil, nil, err
+		}
+		state = &resumeState{
+			uploadID: initMultipartUploadResult.UploadID,
+			partSize: initMultipartUploadResult.PartSize,
+			done:     make(map[int]bool),
 		}
 	}
 
-	initMultipartUploadConfig := &InitMultipartUploadConfig{
-		Path:          config.Path,
-		ContentLength: fileinfo.Size(),
-		PartSize:      config.ResumePartSize,
-		ContentType:   config.Headers["Content-Type"],
-		OrderUpload:   true,
+	breakpoint = &BreakPointConfig{
+		UploadID:    state.uploadID,
+		PartSize:    state.partSize,
+		FileSize:    fileinfo.Size(),
+		FileModTime: fileinfo.ModTime(),
+		LastTime:    time.Now(),
+		Fingerprint: config.Fingerprint,
+		Disorder:    !order,
 	}
-	initMultipartUploadResult, err := up.InitMultipartUpload(initMultipartUploadConfig)
-	if err != nil {
-		return nil, err
+	if up.Recorder != nil {
+		up.Recorder.Set(config.Path, breakpoint)
 	}
-	return &ResumeProcessResult{
-		UploadID:     initMultipartUploadResult.UploadID,
-		Path:         initMultipartUploadConfig.Path,
-		NextPartID:   0,
-		NextPartSize: config.ResumePartSize,
-		Parts:        make([]*DisorderPart, 0),
-	}, nil
+	return breakpoint, state, nil
 }
 
-func (up *UpYun) resumePut(config *PutObjectConfig) error {
-	f, ok := config.Reader.(*os.File)
+// readerAtInfo describes the reader of a resume upload which is not a file.
+type readerAtInfo struct {
+	size int64
+}
+
+func (i readerAtInfo) Name() string       { return "" }
+func (i readerAtInfo) Size() int64        { return i.size }
+func (i readerAtInfo) Mode() fs.FileMode  { return 0 }
+func (i readerAtInfo) ModTime() time.Time { return time.Time{} }
+func (i readerAtInfo) IsDir() bool        { return false }
+func (i readerAtInfo) Sys() interface{}   { return nil }
+
+func getResumeReader(config *PutObjectConfig) (io.ReaderAt, os.FileInfo, error) {
+	if f, ok := config.Reader.(*os.File); ok {
+		fileinfo, err := f.Stat()
+		if err != nil {
+			return nil, nil, errorOperation("get file info failed", err)
+		}
+		return f, fileinfo, nil
+	}
+
+	r, ok := config.Reader.(io.ReaderAt)
 	if !ok {
-		return errorOperation("type assertion failed", nil)
+		return nil, nil, errorOperation("type assertion failed", nil)
+	}
+	size := config.ContentLength
+	if v, ok := config.Reader.(interface{ Size() int64 }); ok && size <= 0 {
+		size = v.Size()
+	}
+	if size <= 0 {
+		return nil, nil, errorOperation("resume upload needs ContentLength", nil)
 	}
+	return r, readerAtInfo{size: size}, nil
+}
 
-	fileinfo, err := f.Stat()
+func (up *UpYun) resumePut(ctx context.Context, config *PutObjectConfig) error {
+	f, fileinfo, err := getResumeReader(config)
 	if err != nil {
-		return errorOperation("get file info failed", err)
+		return err
+	}
+
+	if config.Headers == nil {
+		config.Headers = make(map[string]string)
 	}
 
 	fsize := fileinfo.Size()
 	if fsize < minResumePutFileSize {
-		return up.put(config)
+		if _, ok := config.Reader.(*os.File); !ok && !hasHeader(config.Headers, "Content-Length") {
+			config.Headers["Content-Length"] = strconv.FormatInt(fsize, 10)
+		}
+		return up.put(ctx, config)
 	}
 
 	if config.ResumePartSize == 0 {
 		config.ResumePartSize = DefaultPartSize
 	}
 
-	if config.Headers == nil {
-		config.Headers = make(map[string]string)
+	if config.ResumeConcurrency > 1 {
+		return up.resumePutDisorder(ctx, config, f, fileinfo)
 	}
 
-	var breakpoint *BreakPointConfig
-	if up.Recorder != nil {
-		breakpoint = up.Recorder.Get(config.Path)
+	breakpoint, state, err := up.getResumeState(ctx, config, f, fileinfo, true)
+	if err != nil {
+		return err
 	}
-	// first upload or file has expired
-	maxPartID := int((fsize+config.ResumePartSize-1)/config.ResumePartSize - 1)
-
-	if breakpoint == nil || isRecordExpired(fileinfo, breakpoint) {
-		uploadProcess, err := up.getMultipartUploadProcess(config, fileinfo)
-		if err != nil {
-			return err
-		}
+	breakpoint.PartID = state.nextPart()
+	maxPartID := int((fsize+breakpoint.PartSize-1)/breakpoint.PartSize - 1)
 
-		breakpoint = &BreakPointConfig{
-			UploadID: uploadProcess.UploadID,
-			PartSize: uploadProcess.NextPartSize,
-			PartID:   int(uploadProcess.NextPartID),
-		}
-
-		if up.Recorder != nil {
-			up.Recorder.Set(config.Path, breakpoint)
-		}
+	doneBytes := int64(breakpoint.PartID) * breakpoint.PartSize
+	if doneBytes > fsize {
+		doneBytes = fsize
 	}
+	progressFromContext(ctx).setParts(fsize, maxPartID+1, breakpoint.PartID, doneBytes)
+
 	// parID > maxPartID means all part has uploaded
 	if breakpoint.PartID <= maxPartID {
-		breakpoint, err = up.resumeUploadPart(config, breakpoint, f, fileinfo)
+		breakpoint, err = up.resumeUploadPart(ctx, config, breakpoint, f, fileinfo)
 		if err != nil {
 			return err
 		}
@@ -371,11 +476,10 @@ func (up *UpYun) resumePut(config *PutObjectConfig) error {
 
 	completeConfig := &CompleteMultipartUploadConfig{}
 	if config.UseMD5 {
-		f.Seek(0, 0)
-		completeConfig.Md5, _ = md5File(f)
+		completeConfig.Md5, _ = md5File(io.NewSectionReader(f, 0, fsize))
 	}
 
-	err = up.CompleteMultipartUpload(
+	err = up.CompleteMultipartUploadContext(ctx,
 		&InitMultipartUploadResult{
 			UploadID: breakpoint.UploadID,
 			Path:     config.Path,
@@ -395,7 +499,128 @@ func (up *UpYun) resumePut(config *PutObjectConfig) error {
 	return nil
 }
 
+// resumePutDisorder uploads the parts of r with config.ResumeConcurrency
+// workers, skipping the parts the server already has.
+func (up *UpYun) resumePutDisorder(ctx context.Context, config *PutObjectConfig, r io.ReaderAt, fileinfo os.FileInfo) error {
+	breakpoint, state, err := up.getResumeState(ctx, config, r, fileinfo, false)
+	if err != nil {
+		return err
+	}
+
+	initResult := &InitMultipartUploadResult{
+		UploadID: breakpoint.UploadID,
+		Path:     config.Path,
+		PartSize: breakpoint.PartSize,
+	}
+	if err := up.uploadDisorderParts(ctx, config, initResult, r, fileinfo.Size(), state.done); err != nil {
+		breakpoint.LastTime = time.Now()
+		if up.Recorder != nil {
+			up.Recorder.Set(config.Path, breakpoint)
+		}
+		return err
+	}
+
+	completeConfig := &CompleteMultipartUploadConfig{}
+	if config.UseMD5 {
+		completeConfig.Md5, _ = md5File(io.NewSectionReader(r, 0, fileinfo.Size()))
+	}
+	if err := up.CompleteMultipartUploadContext(ctx, initResult, completeConfig); err != nil {
+		breakpoint.LastTime = time.Now()
+		if up.Recorder != nil {
+			up.Recorder.Set(config.Path, breakpoint)
+		}
+		return err
+	}
+
+	if up.Recorder != nil {
+		up.Recorder.Delete(config.Path)
+	}
+	return nil
+}
+
+// uploadDisorderParts uploads every part of r missing from done, the first
+// failure cancels the other workers.
+func (up *UpYun) uploadDisorderParts(ctx context.Context, config *PutObjectConfig, initResult *InitMultipartUploadResult,
+	r io.ReaderAt, fsize int64, done map[int]bool) error {
+	partSize := initResult.PartSize
+	partNum := int((fsize + partSize - 1) / partSize)
+	partSizeOf := func(id int) int64 {
+		if n := fsize - int64(id)*partSize; n < partSize {
+			return n
+		}
+		return partSize
+	}
+	var doneBytes int64
+	for id := range done {
+		doneBytes += partSizeOf(id)
+	}
+	progress := progressFromContext(ctx)
+	progress.setParts(fsize, partNum, len(done), doneBytes)
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var (
+		wg       sync.WaitGroup
+		once     sync.Once
+		firstErr error
+	)
+	parts := make(chan int)
+	for i := 0; i < config.ResumeConcurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for id := range parts {
+				offset, n := int64(id)*partSize, partSizeOf(id)
+				err := up.retryPart(ctx, config.MaxResumePutTries, func(ctx context.Context) error {
+					var reader io.Reader = io.NewSectionReader(r, offset, n)
+					if config.ProxyReader != nil {
+						reader = config.ProxyReader(offset, reader)
+					}
+					return up.UploadPartContext(ctx, initResult, &UploadPartConfig{
+						PartID:   id,
+						PartSize: n,
+						Reader:   reader,
+					})
+				})
+				if err != nil {
+					once.Do(func() {
+						firstErr = err
+						cancel()
+					})
+					return
+				}
+				progress.partDone()
+			}
+		}()
+	}
+
+feed:
+	for id := 0; id < partNum; id++ {
+		if done[id] {
+			continue
+		}
+		select {
+		case parts <- id:
+		case <-ctx.Done():
+			break feed
+		}
+	}
+	close(parts)
+	wg.Wait()
+
+	if firstErr != nil {
+		return firstErr
+	}
+	return ctx.Err()
+}
+
 func (up *UpYun) Put(config *PutObjectConfig) (err error) {
+	return up.PutContext(context.Background(), config)
+}
+
+func (up *UpYun) PutContext(ctx context.Context, config *PutObjectConfig) (err error) {
+	ctx = withProgress(ctx, newProgressTracker(config.Progress, config.Path))
 	if config.LocalPath != "" {
 		var fd *os.File
 		if fd, err = os.Open(config.LocalPath); err != nil {
@@ -406,19 +631,23 @@ func (up *UpYun) Put(config *PutObjectConfig) (err error) {
 	}
 
 	if config.UseResumeUpload {
-		return up.resumePut(config)
+		return up.resumePut(ctx, config)
 	}
-	return up.put(config)
+	return up.put(ctx, config)
 }
 
 func (up *UpYun) Move(config *MoveObjectConfig) error {
+	return up.MoveContext(context.Background(), config)
+}
+
+func (up *UpYun) MoveContext(ctx context.Context, config *MoveObjectConfig) error {
 	headers := map[string]string{
 		"X-Upyun-Move-Source": path.Join("/", up.Bucket, escapeUri(config.SrcPath)),
 	}
 	for k, v := range config.Headers {
 		headers[k] = v
 	}
-	_, err := up.doRESTRequest(&restReqConfig{
+	_, err := up.doRESTRequest(ctx, &restReqConfig{
 		method:  "PUT",
 		uri:     config.DestPath,
 		headers: headers,
@@ -430,13 +659,17 @@ func (up *UpYun) Move(config *MoveObjectConfig) error {
 }
 
 func (up *UpYun) Copy(config *CopyObjectConfig) error {
+	return up.CopyContext(context.Background(), config)
+}
+
+func (up *UpYun) CopyContext(ctx context.Context, config *CopyObjectConfig) error {
 	headers := map[string]string{
 		"X-Upyun-Copy-Source": path.Join("/", up.Bucket, escapeUri(config.SrcPath)),
 	}
 	for k, v := range config.Headers {
 		headers[k] = v
 	}
-	_, err := up.doRESTRequest(&restReqConfig{
+	_, err := up.doRESTRequest(ctx, &restReqConfig{
 		method:  "PUT",
 		uri:     config.DestPath,
 		headers: headers,
@@ -448,6 +681,10 @@ func (up *UpYun) Copy(config *CopyObjectConfig) error {
 }
 
 func (up *UpYun) InitMultipartUpload(config *InitMultipartUploadConfig) (*InitMultipartUploadResult, error) {
+	return up.InitMultipartUploadContext(context.Background(), config)
+}
+
+func (up *UpYun) InitMultipartUploadContext(ctx context.Context, config *InitMultipartUploadConfig) (*InitMultipartUploadResult, error) {
 	partSize, _, err := getPartInfo(config.PartSize, config.ContentLength)
 	if err != nil {
 		return nil, errorOperation("init multipart", err)
@@ -462,7 +699,7 @@ func (up *UpYun) InitMultipartUpload(config *InitMultipartUploadConfig) (*InitMu
 		headers["X-Upyun-Multi-Disorder"] = "true"
 	}
 	headers["X-Upyun-Multi-Part-Size"] = strconv.FormatInt(partSize, 10)
-	resp, err := up.doRESTRequest(&restReqConfig{
+	resp, err := up.doRESTRequest(ctx, &restReqConfig{
 		method:    "PUT",
 		uri:       config.Path,
 		headers:   headers,
@@ -478,13 +715,17 @@ func (up *UpYun) InitMultipartUpload(config *InitMultipartUploadConfig) (*InitMu
 	}, nil
 }
 func (up *UpYun) UploadPart(initResult *InitMultipartUploadResult, part *UploadPartConfig) error {
+	return up.UploadPartContext(context.Background(), initResult, part)
+}
+
+func (up *UpYun) UploadPartContext(ctx context.Context, initResult *InitMultipartUploadResult, part *UploadPartConfig) error {
 	headers := make(map[string]string)
 	headers["X-Upyun-Multi-Stage"] = "upload"
 	headers["X-Upyun-Multi-Uuid"] = initResult.UploadID
 	headers["X-Upyun-Part-Id"] = strconv.FormatInt(int64(part.PartID), 10)
 	headers["Content-Length"] = strconv.FormatInt(part.PartSize, 10)
 
-	_, err := up.doRESTRequest(&restReqConfig{
+	_, err := up.doRESTRequest(ctx, &restReqConfig{
 		method:    "PUT",
 		uri:       initResult.Path,
 		headers:   headers,
@@ -498,6 +739,10 @@ func (up *UpYun) UploadPart(initResult *InitMultipartUploadResult, part *UploadP
 	return nil
 }
 func (up *UpYun) CompleteMultipartUpload(initResult *InitMultipartUploadResult, config *CompleteMultipartUploadConfig) error {
+	return up.CompleteMultipartUploadContext(context.Background(), initResult, config)
+}
+
+func (up *UpYun) CompleteMultipartUploadContext(ctx context.Context, initResult *InitMultipartUploadResult, config *CompleteMultipartUploadConfig) error {
 	headers := make(map[string]string)
 	headers["X-Upyun-Multi-Stage"] = "complete"
 	headers["X-Upyun-Multi-Uuid"] = initResult.UploadID
@@ -506,7 +751,7 @@ func (up *UpYun) CompleteMultipartUpload(initResult *InitMultipartUploadResult,
 			headers["X-Upyun-Multi-Md5"] = config.Md5
 		}
 	}
-	_, err := up.doRESTRequest(&restReqConfig{
+	_, err := up.doRESTRequest(ctx, &restReqConfig{
 		method:  "PUT",
 		uri:     initResult.Path,
 		headers: headers,
@@ -517,6 +762,10 @@ func (up *UpYun) CompleteMultipartUpload(initResult *InitMultipartUploadResult,
 	return nil
 }
 func (up *UpYun) ListMultipartUploads(config *ListMultipartConfig) (*ListMultipartUploadResult, error) {
+	return up.ListMultipartUploadsContext(context.Background(), config)
+}
+
+func (up *UpYun) ListMultipartUploadsContext(ctx context.Context, config *ListMultipartConfig) (*ListMultipartUploadResult, error) {
 	headers := make(map[string]string)
 	headers["X-Upyun-List-Type"] = "multi"
 	if config.Prefix != "" {
@@ -525,8 +774,11 @@ func (up *UpYun) ListMultipartUploads(config *ListMultipartConfig) (*ListMultipa
 	if config.Limit > 0 {
 		headers["X-Upyun-List-Limit"] = strconv.FormatInt(config.Limit, 10)
 	}
+	if config.Iter != "" {
+		headers["X-Upyun-List-Iter"] = config.Iter
+	}
 
-	res, err := up.doRESTRequest(&restReqConfig{
+	res, err := up.doRESTRequest(ctx, &restReqConfig{
 		method:    "GET",
 		headers:   headers,
 		uri:       "/",
@@ -536,6 +788,7 @@ func (up *UpYun) ListMultipartUploads(config *ListMultipartConfig) (*ListMultipa
 	if err != nil {
 		return nil, errorOperation("list multipart", err)
 	}
+	defer res.Body.Close()
 
 	body, err := io.ReadAll(res.Body)
 	if err != nil {
@@ -551,13 +804,17 @@ func (up *UpYun) ListMultipartUploads(config *ListMultipartConfig) (*ListMultipa
 }
 
 func (up *UpYun) ListMultipartParts(intiResult *InitMultipartUploadResult, config *ListMultipartPartsConfig) (*ListUploadedPartsResult, error) {
+	return up.ListMultipartPartsContext(context.Background(), intiResult, config)
+}
+
+func (up *UpYun) ListMultipartPartsContext(ctx context.Context, intiResult *InitMultipartUploadResult, config *ListMultipartPartsConfig) (*ListUploadedPartsResult, error) {
 	headers := make(map[string]string)
 	headers["X-Upyun-Multi-Uuid"] = intiResult.UploadID
 
 	if config.BeginID > 0 {
 		headers["X-Upyun-Part-Id"] = fmt.Sprint(config.BeginID)
 	}
-	res, err := up.doRESTRequest(&restReqConfig{
+	res, err := up.doRESTRequest(ctx, &restReqConfig{
 		method:    "GET",
 		headers:   headers,
 		uri:       intiResult.Path,
@@ -567,6 +824,7 @@ func (up *UpYun) ListMultipartParts(intiResult *InitMultipartUploadResult, confi
 	if err != nil {
 		return nil, errorOperation("list multipart parts", err)
 	}
+	defer res.Body.Close()
 
 	body, err := io.ReadAll(res.Body)
 	if err != nil {
@@ -581,6 +839,10 @@ func (up *UpYun) ListMultipartParts(intiResult *InitMultipartUploadResult, confi
 	return result, nil
 }
 func (up *UpYun) Delete(config *DeleteObjectConfig) error {
+	return up.DeleteContext(context.Background(), config)
+}
+
+func (up *UpYun) DeleteContext(ctx context.Context, config *DeleteObjectConfig) error {
 	headers := map[string]string{}
 	if config.Async {
 		headers["x-upyun-async"] = "true"
@@ -588,7 +850,7 @@ func (up *UpYun) Delete(config *DeleteObjectConfig) error {
 	if config.Folder {
 		headers["x-upyun-folder"] = "true"
 	}
-	_, err := up.doRESTRequest(&restReqConfig{
+	_, err := up.doRESTRequest(ctx, &restReqConfig{
 		method:    "DELETE",
 		uri:       config.Path,
 		headers:   headers,
@@ -602,11 +864,15 @@ func (up *UpYun) Delete(config *DeleteObjectConfig) error {
 
 // GetRequest return response
 func (up *UpYun) GetRequest(config *GetRequestConfig) (*http.Response, error) {
+	return up.GetRequestContext(context.Background(), config)
+}
+
+func (up *UpYun) GetRequestContext(ctx context.Context, config *GetRequestConfig) (*http.Response, error) {
 	if config.Path == "" {
 		return nil, errors.New("needed set config.Path")
 	}
 
-	resp, err := up.doRESTRequest(&restReqConfig{
+	resp, err := up.doRESTRequest(ctx, &restReqConfig{
 		method:  "GET",
 		uri:     config.Path,
 		headers: config.Headers,
@@ -619,7 +885,11 @@ func (up *UpYun) GetRequest(config *GetRequestConfig) (*http.Response, error) {
 }
 
 func (up *UpYun) GetInfoWithHeaders(path string, headers map[string]string) (*FileInfo, error) {
-	resp, err := up.doRESTRequest(&restReqConfig{
+	return up.GetInfoWithHeadersContext(context.Background(), path, headers)
+}
+
+func (up *UpYun) GetInfoWithHeadersContext(ctx context.Context, path string, headers map[string]string) (*FileInfo, error) {
+	resp, err := up.doRESTRequest(ctx, &restReqConfig{
 		method:    "HEAD",
 		uri:       path,
 		headers:   headers,
@@ -634,7 +904,11 @@ func (up *UpYun) GetInfoWithHeaders(path string, headers map[string]string) (*Fi
 }
 
 func (up *UpYun) GetInfo(path string) (*FileInfo, error) {
-	resp, err := up.doRESTRequest(&restReqConfig{
+	return up.GetInfoContext(context.Background(), path)
+}
+
+func (up *UpYun) GetInfoContext(ctx context.Context, path string) (*FileInfo, error) {
+	resp, err := up.doRESTRequest(ctx, &restReqConfig{
 		method:    "HEAD",
 		uri:       path,
 		closeBody: true,
@@ -648,6 +922,10 @@ func (up *UpYun) GetInfo(path string) (*FileInfo, error) {
 }
 
 func (up *UpYun) List(config *GetObjectsConfig) error {
+	return up.ListContext(context.Background(), config)
+}
+
+func (up *UpYun) ListContext(ctx context.Context, config *GetObjectsConfig) error {
 	if config.ObjectsChan == nil {
 		return errors.New("ObjectsChan is nil")
 	}
@@ -675,21 +953,13 @@ func (up *UpYun) List(config *GetObjectsConfig) error {
 	}
 
 	for {
-		resp, err := up.doRESTRequest(&restReqConfig{
+		resp, err := up.doRESTRequest(ctx, &restReqConfig{
 			method:  "GET",
 			uri:     config.Path,
 			headers: config.Headers,
 		})
 
 		if err != nil {
-			var nerr net.Error
-			if ok := errors.As(err, &nerr); ok {
-				config.try++
-				if config.MaxListTries == 0 || config.try < config.MaxListTries {
-					time.Sleep(10 * time.Millisecond)
-					continue
-				}
-			}
 			return errorOperation("list", err)
 		}
 
@@ -715,17 +985,16 @@ func (up *UpYun) List(config *GetObjectsConfig) error {
 					MaxListLevel:   config.MaxListLevel,
 					level:          config.level + 1,
 					rootDir:        path.Join(config.rootDir, fInfo.Name),
-					try:            config.try,
 					objNum:         config.objNum,
 				}
-				if err = up.List(rConfig); err != nil {
+				if err = up.ListContext(ctx, rConfig); err != nil {
 					return err
 				}
 				// empty folder
 				if config.objNum == rConfig.objNum {
 					fInfo.IsEmptyDir = true
 				}
-				config.try, config.objNum = rConfig.try, rConfig.objNum
+				config.objNum = rConfig.objNum
 			}
 			if config.rootDir != "" {
 				fInfo.Name = path.Join(config.rootDir, fInfo.Name)
@@ -735,7 +1004,11 @@ func (up *UpYun) List(config *GetObjectsConfig) error {
 			case <-config.QuitChan:
 				return nil
 			default:
-				config.ObjectsChan <- fInfo
+				select {
+				case config.ObjectsChan <- fInfo:
+				case <-ctx.Done():
+					return errorOperation("list", ctx.Err())
+				}
 			}
 
 			config.objNum++
@@ -744,7 +1017,7 @@ func (up *UpYun) List(config *GetObjectsConfig) error {
 			}
 		}
 
-		if iter == "g2gCZAAEbmV4dGQAA2VvZg" {
+		if iter == listEndIter {
 			return nil
 		}
 		config.Headers["X-List-Iter"] = iter
@@ -752,6 +1025,10 @@ func (up *UpYun) List(config *GetObjectsConfig) error {
 }
 
 func (up *UpYun) ListObjects(config *ListObjectsConfig) (fileInfos []*FileInfo, iter string, err error) {
+	return up.ListObjectsContext(context.Background(), config)
+}
+
+func (up *UpYun) ListObjectsContext(ctx context.Context, config *ListObjectsConfig) (fileInfos []*FileInfo, iter string, err error) {
 	if config.Headers == nil {
 		config.Headers = make(map[string]string)
 	}
@@ -770,34 +1047,15 @@ func (up *UpYun) ListObjects(config *ListObjectsConfig) (fileInfos []*FileInfo,
 		config.Headers["x-list-iter"] = config.Iter
 	}
 
-	if config.MaxListTries <= 0 {
-		config.MaxListTries = MaxListTries
-	}
-
 	config.Headers["X-UpYun-Folder"] = "true"
 	config.Headers["Accept"] = "application/json"
-	var resp *http.Response
-	try := 0
-	for {
-		resp, err = up.doRESTRequest(&restReqConfig{
-			method:  "GET",
-			uri:     config.Path,
-			headers: config.Headers,
-		})
-
-		// 重试
-		if err != nil {
-			var nerr net.Error
-			if ok := errors.As(err, &nerr); ok {
-				try++
-				if try < config.MaxListTries {
-					time.Sleep(10 * time.Millisecond)
-					continue
-				}
-			}
-			return nil, "", errorOperation("list", err)
-		}
-		break
+	resp, err := up.doRESTRequest(ctx, &restReqConfig{
+		method:  "GET",
+		uri:     config.Path,
+		headers: config.Headers,
+	})
+	if err != nil {
+		return nil, "", errorOperation("list", err)
 	}
 
 	// 读取列表
@@ -812,7 +1070,7 @@ func (up *UpYun) ListObjects(config *ListObjectsConfig) (fileInfos []*FileInfo,
 		return nil, "", errorOperation("list read body", err)
 	}
 
-	if iter == "g2gCZAAEbmV4dGQAA2VvZg" {
+	if iter == listEndIter {
 		return files, "", nil
 	}
 
@@ -820,10 +1078,14 @@ func (up *UpYun) ListObjects(config *ListObjectsConfig) (fileInfos []*FileInfo,
 }
 
 func (up *UpYun) ModifyMetadata(config *ModifyMetadataConfig) error {
+	return up.ModifyMetadataContext(context.Background(), config)
+}
+
+func (up *UpYun) ModifyMetadataContext(ctx context.Context, config *ModifyMetadataConfig) error {
 	if config.Operation == "" {
 		config.Operation = "merge"
 	}
-	_, err := up.doRESTRequest(&restReqConfig{
+	_, err := up.doRESTRequest(ctx, &restReqConfig{
 		method:    "PATCH",
 		uri:       config.Path,
 		query:     "metadata=" + config.Operation,
@@ -836,7 +1098,7 @@ func (up *UpYun) ModifyMetadata(config *ModifyMetadataConfig) error {
 	return nil
 }
 
-func (up *UpYun) doRESTRequest(config *restReqConfig) (*http.Response, error) {
+func (up *UpYun) doRESTRequest(ctx context.Context, config *restReqConfig) (*http.Response, error) {
 	escUri := path.Join("/", up.Bucket, escapeUri(config.uri))
 	if strings.HasSuffix(config.uri, "/") {
 		escUri += "/"
@@ -854,7 +1116,6 @@ func (up *UpYun) doRESTRequest(config *restReqConfig) (*http.Response, error) {
 		headers[k] = v
 	}
 
-	headers["Date"] = makeRFC1123Date(time.Now())
 	headers["Host"] = "v0.api.upyun.com"
 
 	if !hasMD5 && config.useMD5 {
@@ -879,25 +1140,21 @@ func (up *UpYun) doRESTRequest(config *restReqConfig) (*http.Response, error) {
 			}
 			headers["Content-Length"] = fmt.Sprint(size)
 		}
-		headers["Authorization"] = up.MakeRESTAuth(&RESTAuthConfig{
-			Method:    config.method,
-			Uri:       escUri,
-			DateStr:   headers["Date"],
-			LengthStr: headers["Content-Length"],
-		})
-	} else {
-		headers["Authorization"] = up.MakeUnifiedAuth(&UnifiedAuthConfig{
-			Method:     config.method,
-			Uri:        escUri,
-			DateStr:    headers["Date"],
-			ContentMD5: headers["Content-MD5"],
-		})
+	}
+	sign := func(headers map[string]string) error {
+		keys, err := up.signingKeys()
+		if err != nil {
+			return err
+		}
+		headers["Authorization"] = up.makeRequestAuth(keys, config.method, escUri, headers["Date"],
+			headers["Content-MD5"], headers["Content-Length"])
+		return nil
 	}
 
 	endpoint := up.getEndpoint("v0.api.upyun.com")
 	url := fmt.Sprintf("%s%s", endpoint, escUri)
 
-	resp, err := up.doHTTPRequest(config.method, url, headers, config.httpBody)
+	resp, err := up.doHTTPRequest(ctx, config.method, url, headers, config.httpBody, sign)
 	if err != nil {
 		return nil, err
 	}
@@ -917,55 +1174,56 @@ type BreakPointConfig struct {
 	FileSize    int64
 	FileModTime time.Time
 	LastTime    time.Time
+	Fingerprint string // PutObjectConfig.Fingerprint of the uploaded reader
+	Disorder    bool   // parts are uploaded concurrently in the disorder mode
 }
 
-func (up *UpYun) resumeUploadPart(config *PutObjectConfig, breakpoint *BreakPointConfig, f io.ReadSeeker, fileInfo fs.FileInfo) (*BreakPointConfig, error) {
+func (up *UpYun) resumeUploadPart(ctx context.Context, config *PutObjectConfig, breakpoint *BreakPointConfig, r io.ReaderAt, fileInfo fs.FileInfo) (*BreakPointConfig, error) {
 	fsize := fileInfo.Size()
-	partID := breakpoint.PartID
-	curSize, partSize := int64(partID)*breakpoint.PartSize, breakpoint.PartSize
-	bytesLeft := fsize - curSize
-	ch := make(chan *Chunk, 1)
-	var err error
-	if curSize > 0 {
-		f.Seek(curSize, 0)
+	partSize := breakpoint.PartSize
+	initResult := &InitMultipartUploadResult{
+		UploadID: breakpoint.UploadID,
+		Path:     config.Path,
+		PartSize: partSize,
 	}
-	var reader io.Reader
-	if config.ProxyReader != nil {
-		reader = config.ProxyReader(curSize, f)
-	} else {
-		reader = f
-	}
-	go GetReadChunk(reader, bytesLeft, partSize, ch)
-	for chunk := range ch {
-		try := 0
-		for ; config.MaxResumePutTries == 0 || try < config.MaxResumePutTries; try++ {
-			err = up.UploadPart(
-				&InitMultipartUploadResult{
-					UploadID: breakpoint.UploadID,
-					Path:     config.Path,
-					PartSize: breakpoint.PartSize,
-				},
-				&UploadPartConfig{
-					PartID:   partID + chunk.ID(),
-					PartSize: int64(chunk.Len()),
-					Reader:   chunk,
-				})
-			if err == nil {
-				break
+
+	var err error
+	for offset := int64(breakpoint.PartID) * partSize; offset < fsize; offset += partSize {
+		if err = ctx.Err(); err != nil {
+			break
+		}
+		n := partSize
+		if fsize-offset < n {
+			n = fsize - offset
+		}
+		// every try reads the part again from r
+		err = up.retryPart(ctx, config.MaxResumePutTries, func(ctx context.Context) error {
+			var reader io.Reader = io.NewSectionReader(r, offset, n)
+			if config.ProxyReader != nil {
+				reader = config.ProxyReader(offset, reader)
 			}
+			return up.UploadPartContext(ctx, initResult, &UploadPartConfig{
+				PartID:   breakpoint.PartID,
+				PartSize: n,
+				Reader:   reader,
+			})
+		})
+		if err != nil {
+			break
 		}
+		breakpoint.PartID++
+		progressFromContext(ctx).partDone()
+	}
 
-		if config.MaxResumePutTries > 0 && try == config.MaxResumePutTries {
-			breakpoint.PartID = partID + chunk.ID()
-			breakpoint.FileSize = fsize
-			breakpoint.LastTime = time.Now()
-			breakpoint.FileModTime = fileInfo.ModTime()
-			if up.Recorder != nil {
-				up.Recorder.Set(config.Path, breakpoint)
-			}
-			return breakpoint, err
+	if err != nil {
+		// breakpoint.PartID points to the part that failed
+		breakpoint.FileSize = fsize
+		breakpoint.LastTime = time.Now()
+		breakpoint.FileModTime = fileInfo.ModTime()
+		if up.Recorder != nil {
+			up.Recorder.Set(config.Path, breakpoint)
 		}
-		breakpoint.PartID = partID + chunk.ID() + 1
+		return breakpoint, err
 	}
 	return breakpoint, nil
 }
@@ -993,12 +1251,16 @@ type ResumeProcessResult struct {
 }
 
 func (up *UpYun) GetResumeProcess(path string) (*ResumeProcessResult, error) {
+	return up.GetResumeProcessContext(context.Background(), path)
+}
+
+func (up *UpYun) GetResumeProcessContext(ctx context.Context, path string) (*ResumeProcessResult, error) {
 	var partID, partSize, size int64
 	var createTime time.Time
 
 	headers := make(map[string]string)
 	headers["X-Upyun-Multi-Info"] = "true"
-	resp, err := up.doRESTRequest(&restReqConfig{
+	resp, err := up.doRESTRequest(ctx, &restReqConfig{
 		headers:   headers,
 		method:    "GET",
 		uri:       path,
@@ -2,7 +2,10 @@ package upyun
 
 import (
 	"bytes"
+	"context"
+	"errors"
 	"fmt"
+	"io"
 	"net"
 	"os"
 	"path"
@@ -302,7 +305,7 @@ func TestResumePut(t *testing.T) {
 		point := test.BreakPointConfig
 
 		resume.Set(path, &point)
-		err = up.resumePut(config)
+		err = up.resumePut(context.Background(), config)
 		Nil(t, err)
 
 		// expect result
@@ -321,7 +324,7 @@ func TestResumePut(t *testing.T) {
 	// resumePut
 	config.Path = path
 	// resume.Set(path, testPoint)
-	err = up.resumePut(config)
+	err = up.resumePut(context.Background(), config)
 	Nil(t, err)
 
 	// upload success
@@ -337,6 +340,71 @@ func TestResumePut(t *testing.T) {
 	Equal(t, fileMd5, pathFileInfo.MD5)
 }
 
+func TestResumePutConcurrent(t *testing.T) {
+	fname := "10M_concurrent"
+	fd, _ := os.Create(fname)
+	NotNil(t, fd)
+	kb := strings.Repeat("U", 1024)
+	for i := 0; i < (minResumePutFileSize/1024 + 2); i++ {
+		fd.WriteString(kb)
+	}
+	defer fd.Close()
+	defer os.RemoveAll(fname)
+	fd.Seek(0, 0)
+
+	path := path.Join(REST_DIR, "FILE_CONCURRENT")
+	up.SetRecorder(&MemoryRecorder{})
+	err := up.Put(&PutObjectConfig{
+		Path:              path,
+		Reader:            fd,
+		UseMD5:            true,
+		UseResumeUpload:   true,
+		ResumePartSize:    DefaultPartSize,
+		ResumeConcurrency: 4,
+		MaxResumePutTries: 3,
+	})
+	Nil(t, err)
+
+	var nilPoint *BreakPointConfig
+	Equal(t, up.Recorder.Get(path), nilPoint)
+
+	fileMd5, err := md5File(fd)
+	Nil(t, err)
+	pathFileInfo, err := up.GetInfo(path)
+	Nil(t, err)
+	Equal(t, fileMd5, pathFileInfo.MD5)
+
+	err = up.Delete(&DeleteObjectConfig{Path: path})
+	Nil(t, err)
+}
+
+func TestResumePutReaderAt(t *testing.T) {
+	data := bytes.Repeat([]byte("U"), minResumePutFileSize+2048)
+	path := path.Join(REST_DIR, "FILE_READER_AT")
+
+	resume := &MemoryRecorder{}
+	up.SetRecorder(resume)
+	err := up.Put(&PutObjectConfig{
+		Path:              path,
+		Reader:            io.NewSectionReader(bytes.NewReader(data), 0, int64(len(data))),
+		UseMD5:            true,
+		UseResumeUpload:   true,
+		MaxResumePutTries: 3,
+		Fingerprint:       md5Str(string(data)),
+	})
+	Nil(t, err)
+
+	var nilPoint *BreakPointConfig
+	Equal(t, resume.Get(path), nilPoint)
+
+	pathFileInfo, err := up.GetInfo(path)
+	Nil(t, err)
+	Equal(t, md5Str(string(data)), pathFileInfo.MD5)
+
+	err = up.Delete(&DeleteObjectConfig{Path: path})
+	Nil(t, err)
+}
+
 func TestGetWithWriter(t *testing.T) {
 	b := make([]byte, 0)
 	buf := bytes.NewBuffer(b)
@@ -412,6 +480,22 @@ func TestList(t *testing.T) {
 	}
 }
 
+func TestContextCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err := up.GetInfoContext(ctx, REST_FILE_BUF)
+	NotNil(t, err)
+	Equal(t, errors.Is(err, context.Canceled), true)
+
+	ch := make(chan *FileInfo, 10)
+	err = up.ListContext(ctx, &GetObjectsConfig{
+		Path:        REST_DIR,
+		ObjectsChan: ch,
+	})
+	Equal(t, errors.Is(err, context.Canceled), true)
+}
+
 func TestIsNotExist(t *testing.T) {
 	_, err := up.GetInfo("/NotExist")
 	Equal(t, IsNotExist(err), true)
@@ -618,7 +702,7 @@ func TestResumeUpload(t *testing.T) {
 	for _, test := range tests {
 		point := test.BreakPointConfig
 		// resume upload
-		_, err = up.resumeUploadPart(config, &point, fd, fileInfo)
+		_, err = up.resumeUploadPart(context.Background(), config, &point, fd, fileInfo)
 		Nil(t, err)
 		Equal(t, point, test.expected)
 
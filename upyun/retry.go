@@ -0,0 +1,183 @@
+package upyun
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"math"
+	"math/rand"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	defaultRetryBaseDelay = 100 * time.Millisecond
+	defaultRetryMaxDelay  = 10 * time.Second
+)
+
+// RetryPolicy decides whether a failed HTTP request is sent again.
+type RetryPolicy interface {
+	// Retry is called after the attempt-th (starting at 1) attempt failed
+	// with err. It returns how long to wait before the next attempt and
+	// whether there should be a next attempt at all.
+	Retry(attempt int, err error) (time.Duration, bool)
+}
+
+// ExponentialBackoff retries 429, 5xx and network errors with exponentially
+// growing, jittered delays. A Retry-After header sent by the server takes
+// precedence over the computed delay, the request is not retried if it is
+// longer than MaxDelay.
+type ExponentialBackoff struct {
+	// MaxAttempts is the total number of attempts, including the first one.
+	MaxAttempts int
+	// BaseDelay is the delay before the second attempt, default 100ms.
+	BaseDelay time.Duration
+	// MaxDelay caps the delays, default 10s.
+	MaxDelay time.Duration
+}
+
+var (
+	jitterMu   sync.Mutex
+	jitterRand = rand.New(rand.NewSource(time.Now().UnixNano()))
+)
+
+func (b *ExponentialBackoff) Retry(attempt int, err error) (time.Duration, bool) {
+	if attempt >= b.MaxAttempts || !IsRetryable(err) {
+		return 0, false
+	}
+	base, maxDelay := b.BaseDelay, b.MaxDelay
+	if base <= 0 {
+		base = defaultRetryBaseDelay
+	}
+	if maxDelay <= 0 {
+		maxDelay = defaultRetryMaxDelay
+	}
+	if d, ok := retryAfter(err); ok {
+		// a server asking to wait longer than MaxDelay is not retried
+		return d, d <= maxDelay
+	}
+	d := maxDelay
+	if shift := attempt - 1; shift < 32 && base<<shift < maxDelay {
+		d = base << shift
+	}
+
+	// equal jitter: keep half of the delay, randomize the other half
+	jitterMu.Lock()
+	d = d/2 + time.Duration(jitterRand.Int63n(int64(d/2)+1))
+	jitterMu.Unlock()
+	return d, true
+}
+
+// IsRetryable reports whether err is worth retrying: 429 Too Many Requests,
+// 5xx responses and network errors. Other 4xx responses and canceled
+// contexts are not.
+func IsRetryable(err error) bool {
+	if err == nil {
+		return false
+	}
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+
+	var ae *Error
+	if errors.As(err, &ae) {
+		return ae.StatusCode == http.StatusTooManyRequests || ae.StatusCode >= 500
+	}
+
+	var nerr net.Error
+	if errors.As(err, &nerr) {
+		return true
+	}
+	return errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF)
+}
+
+// retryAfter parses the Retry-After header of a server error, given either
+// in seconds or as an HTTP date.
+func retryAfter(err error) (time.Duration, bool) {
+	var ae *Error
+	if !errors.As(err, &ae) || ae.Header == nil {
+		return 0, false
+	}
+	v := ae.Header.Get("Retry-After")
+	if v == "" {
+		return 0, false
+	}
+	if sec, err := strconv.Atoi(v); err == nil && sec >= 0 {
+		return time.Duration(sec) * time.Second, true
+	}
+	if t, err := http.ParseTime(v); err == nil {
+		d := time.Until(t)
+		if d < 0 {
+			d = 0
+		}
+		return d, true
+	}
+	return 0, false
+}
+
+// bodyRewinder returns a body that can be sent again after rewinding it with
+// the returned function. It returns false if the body can't be replayed.
+func bodyRewinder(body io.Reader) (io.Reader, func() error, bool) {
+	if body == nil {
+		return nil, func() error { return nil }, true
+	}
+	if v, ok := body.(*bytes.Buffer); ok {
+		body = bytes.NewReader(v.Bytes())
+	}
+	seeker, ok := body.(io.Seeker)
+	if !ok {
+		return nil, nil, false
+	}
+	offset, err := seeker.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return nil, nil, false
+	}
+	return body, func() error {
+		_, err := seeker.Seek(offset, io.SeekStart)
+		return err
+	}, true
+}
+
+type noRetryKey struct{}
+
+// withoutRetry returns a context whose requests are sent once, for callers
+// retrying them on their own.
+func withoutRetry(ctx context.Context) context.Context {
+	return context.WithValue(ctx, noRetryKey{}, true)
+}
+
+func noRetryFromContext(ctx context.Context) bool {
+	v, _ := ctx.Value(noRetryKey{}).(bool)
+	return v
+}
+
+// retryPart calls do until it succeeds, fails with an error which is not
+// worth retrying, or maxTries attempts were made, 0 for no limit. The delays,
+// and whether to go on, are decided by up.RetryPolicy, by an
+// ExponentialBackoff of maxTries attempts if it is nil. The requests made by
+// do are not retried on their own.
+func (up *UpYun) retryPart(ctx context.Context, maxTries int, do func(ctx context.Context) error) error {
+	policy := up.RetryPolicy
+	if policy == nil {
+		attempts := maxTries
+		if attempts <= 0 {
+			attempts = math.MaxInt32
+		}
+		policy = &ExponentialBackoff{MaxAttempts: attempts}
+	}
+	ctx = withoutRetry(ctx)
+	for attempt := 1; ; attempt++ {
+		err := do(ctx)
+		if err == nil || (maxTries > 0 && attempt >= maxTries) || ctx.Err() != nil || !IsRetryable(err) {
+			return err
+		}
+		delay, ok := policy.Retry(attempt, err)
+		if !ok || sleepContext(ctx, delay) != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,52 @@
+package upyun
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestExponentialBackoff(t *testing.T) {
+	policy := &ExponentialBackoff{
+		MaxAttempts: 3,
+		BaseDelay:   100 * time.Millisecond,
+		MaxDelay:    time.Second,
+	}
+
+	d, ok := policy.Retry(1, &Error{StatusCode: http.StatusServiceUnavailable})
+	Equal(t, ok, true)
+	Equal(t, d >= 50*time.Millisecond && d <= 100*time.Millisecond, true)
+
+	d, ok = policy.Retry(2, &Error{StatusCode: http.StatusBadGateway})
+	Equal(t, ok, true)
+	Equal(t, d >= 100*time.Millisecond && d <= 200*time.Millisecond, true)
+
+	_, ok = policy.Retry(3, &Error{StatusCode: http.StatusBadGateway})
+	Equal(t, ok, false)
+
+	_, ok = policy.Retry(1, &Error{StatusCode: http.StatusNotFound})
+	Equal(t, ok, false)
+
+	d, ok = policy.Retry(1, &Error{
+		StatusCode: http.StatusTooManyRequests,
+		Header:     http.Header{"Retry-After": []string{"1"}},
+	})
+	Equal(t, ok, true)
+	Equal(t, d, time.Second)
+
+	// longer than MaxDelay
+	_, ok = policy.Retry(1, &Error{
+		StatusCode: http.StatusTooManyRequests,
+		Header:     http.Header{"Retry-After": []string{"3"}},
+	})
+	Equal(t, ok, false)
+}
+
+func TestIsRetryable(t *testing.T) {
+	Equal(t, IsRetryable(nil), false)
+	Equal(t, IsRetryable(errors.New("x")), false)
+	Equal(t, IsRetryable(&Error{StatusCode: http.StatusForbidden}), false)
+	Equal(t, IsRetryable(&Error{StatusCode: http.StatusInternalServerError}), true)
+	Equal(t, IsRetryable(errorOperation("get", &Error{StatusCode: http.StatusTooManyRequests})), true)
+}
@@ -0,0 +1,216 @@
+package upyun
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// serverDateSkew is how far the Date of a request may be from the clock
+	// of the server
+	serverDateSkew       = 30 * time.Minute
+	defaultPresignExpire = 10 * time.Minute
+	processHost          = "p0.api.upyun.com"
+)
+
+// SignRequestConfig tunes SignRequestWithConfig.
+type SignRequestConfig struct {
+	// ContentMD5: compute and sign the Content-MD5 header of bodies kept in
+	// memory by http.NewRequest, which reads the whole body once more
+	ContentMD5 bool
+}
+
+// SignRequest fills the Date and Authorization headers of req, a request to
+// the REST API or to the processing API at p0.api.upyun.com, so that it can
+// be sent by any HTTP client. The Content-MD5 header is signed if set.
+func (up *UpYun) SignRequest(req *http.Request) error {
+	return up.SignRequestWithConfig(req, &SignRequestConfig{})
+}
+
+// SignRequestWithConfig is SignRequest, computing the Content-MD5 header
+// first with config.ContentMD5.
+func (up *UpYun) SignRequestWithConfig(req *http.Request, config *SignRequestConfig) error {
+	keys, err := up.signingKeys()
+	if err != nil {
+		return errorOperation("sign request", err)
+	}
+	uri := req.URL.EscapedPath()
+	if req.URL.RawQuery != "" {
+		uri += "?" + req.URL.RawQuery
+	}
+	req.Header.Set("Date", makeRFC1123Date(time.Now()))
+
+	if config.ContentMD5 && req.Header.Get("Content-MD5") == "" && req.GetBody != nil && req.ContentLength != 0 {
+		body, err := req.GetBody()
+		if err != nil {
+			return errorOperation("sign request", err)
+		}
+		b, err := io.ReadAll(body)
+		body.Close()
+		if err != nil {
+			return errorOperation("sign request", err)
+		}
+		req.Header.Set("Content-MD5", md5Str(string(b)))
+	}
+
+	if up.deprecated && req.URL.Hostname() == processHost {
+		kwargs, err := processRequestArgs(req)
+		if err != nil {
+			return errorOperation("sign request", err)
+		}
+		req.Header.Set("Authorization", makeProcessAuth(keys, kwargs))
+		return nil
+	}
+	if up.deprecated && req.ContentLength < 0 {
+		return errorOperation("sign request: deprecated auth needs ContentLength", nil)
+	}
+	req.Header.Set("Authorization", up.makeRequestAuth(keys, req.Method, uri, req.Header.Get("Date"),
+		req.Header.Get("Content-MD5"), strconv.FormatInt(req.ContentLength, 10)))
+	return nil
+}
+
+// processRequestArgs returns the arguments signed by MakeProcessAuth, from
+// the query or the form body of req.
+func processRequestArgs(req *http.Request) (map[string]string, error) {
+	values := req.URL.Query()
+	if req.Method == "POST" {
+		if req.GetBody == nil {
+			return nil, fmt.Errorf("process request body cannot be read twice")
+		}
+		body, err := req.GetBody()
+		if err != nil {
+			return nil, err
+		}
+		b, err := io.ReadAll(body)
+		body.Close()
+		if err != nil {
+			return nil, err
+		}
+		if values, err = url.ParseQuery(string(b)); err != nil {
+			return nil, err
+		}
+	}
+	kwargs := make(map[string]string, len(values))
+	for k := range values {
+		kwargs[k] = values.Get(k)
+	}
+	return kwargs, nil
+}
+
+// makeRequestAuth returns the Authorization of a REST request, length is
+// only signed with deprecated auth.
+func (up *UpYun) makeRequestAuth(keys *signKeys, method, uri, date, contentMD5, length string) string {
+	if up.deprecated {
+		return makeRESTAuth(keys, &RESTAuthConfig{
+			Method:    method,
+			Uri:       uri,
+			DateStr:   date,
+			LengthStr: length,
+		})
+	}
+	return makeUnifiedAuth(keys, &UnifiedAuthConfig{
+		Method:     method,
+		Uri:        uri,
+		DateStr:    date,
+		ContentMD5: contentMD5,
+	})
+}
+
+type PresignConfig struct {
+	// Method: default PUT
+	Method string
+	Path   string
+	// ContentMD5: binds the request to this content
+	ContentMD5 string
+	// ContentLength: required by deprecated auth
+	ContentLength int64
+	// Headers: other headers sent with the request, which are not signed
+	Headers map[string]string
+	// ExpireAfter: default 10 minutes, at most 30
+	ExpireAfter time.Duration
+}
+
+// PresignedRequest is a request authorized by a backend and performed by
+// another client, which sends Header as is.
+type PresignedRequest struct {
+	Method     string
+	URL        string
+	Header     map[string]string
+	Expiration time.Time
+}
+
+// PresignRequest authorizes a single request, a PUT of config.Path by
+// default, to be made before the expiration by a client which does not hold
+// the password. The server accepts requests dated up to 30 minutes ago, the
+// Date is set in the past so that the headers expire after
+// config.ExpireAfter.
+func (up *UpYun) PresignRequest(config *PresignConfig) (*PresignedRequest, error) {
+	method := config.Method
+	if method == "" {
+		method = "PUT"
+	}
+	expire := config.ExpireAfter
+	if expire <= 0 {
+		expire = defaultPresignExpire
+	}
+	if expire > serverDateSkew {
+		return nil, errorOperation(fmt.Sprintf("presign: expiration longer than %s", serverDateSkew), nil)
+	}
+	if up.deprecated && method == "PUT" && config.ContentLength <= 0 {
+		return nil, errorOperation("presign: deprecated auth needs ContentLength", nil)
+	}
+	keys, err := up.signingKeys()
+	if err != nil {
+		return nil, errorOperation("presign", err)
+	}
+
+	escUri := path.Join("/", up.Bucket, escapeUri(config.Path))
+	if strings.HasSuffix(config.Path, "/") {
+		escUri += "/"
+	}
+	now := time.Now()
+	date := now.Add(expire - serverDateSkew)
+
+	header := make(map[string]string, len(config.Headers)+4)
+	for k, v := range config.Headers {
+		header[k] = v
+	}
+	header["Date"] = makeRFC1123Date(date)
+	if config.ContentMD5 != "" {
+		header["Content-MD5"] = config.ContentMD5
+	}
+	length := ""
+	if config.ContentLength > 0 {
+		length = strconv.FormatInt(config.ContentLength, 10)
+		header["Content-Length"] = length
+	}
+	header["Authorization"] = up.makeRequestAuth(keys, method, escUri, header["Date"], config.ContentMD5, length)
+
+	return &PresignedRequest{
+		Method:     method,
+		URL:        up.getEndpoint("v0.api.upyun.com") + escUri,
+		Header:     header,
+		Expiration: date.Add(serverDateSkew).Truncate(time.Second),
+	}, nil
+}
+
+// NewRequest returns the presigned request with body.
+func (p *PresignedRequest) NewRequest(body io.Reader) (*http.Request, error) {
+	req, err := http.NewRequest(p.Method, p.URL, body)
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range p.Header {
+		req.Header.Set(k, v)
+	}
+	if v := p.Header["Content-Length"]; v != "" {
+		req.ContentLength, _ = strconv.ParseInt(v, 10, 64)
+	}
+	return req, nil
+}
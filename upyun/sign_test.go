@@ -0,0 +1,68 @@
+package upyun
+
+import (
+	"net/http"
+	"path"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSignRequest(t *testing.T) {
+	signer := NewUpYun(&UpYunConfig{Bucket: "bucket", Operator: "operator", Password: "password"})
+	req, err := http.NewRequest("PUT", "https://v0.api.upyun.com/bucket/a%20b.txt?x=1", strings.NewReader("hello"))
+	Nil(t, err)
+	Nil(t, signer.SignRequest(req))
+	Equal(t, req.Header.Get("Content-MD5"), "")
+	Equal(t, req.Header.Get("Authorization"), signer.MakeUnifiedAuth(&UnifiedAuthConfig{
+		Method:  "PUT",
+		Uri:     "/bucket/a%20b.txt?x=1",
+		DateStr: req.Header.Get("Date"),
+	}))
+
+	// Content-MD5 is opt-in
+	Nil(t, signer.SignRequestWithConfig(req, &SignRequestConfig{ContentMD5: true}))
+	Equal(t, req.Header.Get("Content-MD5"), md5Str("hello"))
+	Equal(t, req.Header.Get("Authorization"), signer.MakeUnifiedAuth(&UnifiedAuthConfig{
+		Method:     "PUT",
+		Uri:        "/bucket/a%20b.txt?x=1",
+		DateStr:    req.Header.Get("Date"),
+		ContentMD5: md5Str("hello"),
+	}))
+
+	p, err := signer.PresignRequest(&PresignConfig{Path: "/a b.txt", ExpireAfter: 5 * time.Minute})
+	Nil(t, err)
+	Equal(t, p.URL, "https://v0.api.upyun.com/bucket/a%20b.txt")
+	date, err := time.Parse(time.RFC1123, p.Header["Date"])
+	Nil(t, err)
+	Equal(t, p.Expiration.Equal(date.Add(serverDateSkew)), true)
+	Equal(t, p.Expiration.Sub(time.Now()) <= 5*time.Minute, true)
+	Equal(t, p.Header["Authorization"], signer.MakeUnifiedAuth(&UnifiedAuthConfig{
+		Method:  "PUT",
+		Uri:     "/bucket/a%20b.txt",
+		DateStr: p.Header["Date"],
+	}))
+	_, err = signer.PresignRequest(&PresignConfig{Path: "/a", ExpireAfter: time.Hour})
+	NotNil(t, err)
+}
+
+func TestPresignRequest(t *testing.T) {
+	key := path.Join(ROOT, "PRESIGN")
+	p, err := up.PresignRequest(&PresignConfig{Path: key, ContentMD5: md5Str("hello")})
+	Nil(t, err)
+
+	req, err := p.NewRequest(strings.NewReader("hello"))
+	Nil(t, err)
+	resp, err := http.DefaultClient.Do(req)
+	Nil(t, err)
+	resp.Body.Close()
+	Equal(t, resp.StatusCode, http.StatusOK)
+
+	// the signature binds the content
+	req, err = p.NewRequest(strings.NewReader("olleh"))
+	Nil(t, err)
+	resp, err = http.DefaultClient.Do(req)
+	Nil(t, err)
+	resp.Body.Close()
+	NotEqual(t, resp.StatusCode, http.StatusOK)
+}
@@ -0,0 +1,463 @@
+package upyun
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultSyncConcurrency = 4
+	// syncMtimeMeta keeps the modification time of the source file, in
+	// nanoseconds since the epoch, in the metadata of uploaded files
+	syncMtimeMeta = "x-upyun-meta-mtime"
+)
+
+type SyncAction int
+
+const (
+	// SyncUpload uploads a local file missing from the bucket
+	SyncUpload SyncAction = iota
+	// SyncOverwrite uploads a local file which differs from the remote one
+	SyncOverwrite
+	// SyncDelete deletes a remote file missing from the local directory
+	SyncDelete
+	// SyncDownload downloads a remote file missing from the local directory
+	SyncDownload
+	// SyncOverwriteLocal downloads a remote file which differs from the
+	// local one
+	SyncOverwriteLocal
+	// SyncDeleteLocal deletes a local file missing from the bucket
+	SyncDeleteLocal
+)
+
+// transfers reports whether the action moves file content.
+func (a SyncAction) transfers() bool {
+	return a != SyncDelete && a != SyncDeleteLocal
+}
+
+func (a SyncAction) String() string {
+	switch a {
+	case SyncUpload:
+		return "upload"
+	case SyncOverwrite:
+		return "overwrite"
+	case SyncDelete:
+		return "delete"
+	case SyncDownload:
+		return "download"
+	case SyncOverwriteLocal:
+		return "overwrite-local"
+	case SyncDeleteLocal:
+		return "delete-local"
+	}
+	return fmt.Sprintf("SyncAction(%d)", int(a))
+}
+
+// SyncConfig provides a configuration to Sync and Mirror methods.
+type SyncConfig struct {
+	LocalDir  string
+	RemoteDir string
+	// Delete: delete the files missing from the source, which are remote
+	// files for Sync and local files for Mirror
+	Delete bool
+	// UseMD5: compare files of the same size by md5 instead of
+	// modification time. Sync stores the modification time of uploaded
+	// files in their metadata. Either costs one HEAD request per file of
+	// the same size unless the listing carries it.
+	UseMD5 bool
+	// Include and Exclude are path.Match patterns matched against the
+	// slash separated path relative to the synced directories, or against
+	// the base name for patterns without '/'
+	Include []string
+	Exclude []string
+	// Concurrency: number of files transferred at the same time, default 4
+	Concurrency int
+	// DryRun: only plan and print the actions to Output
+	DryRun bool
+	Output io.Writer
+}
+
+// SyncItem is an action of a sync plan, and its outcome once executed.
+type SyncItem struct {
+	Action     SyncAction
+	Path       string // relative to the synced directories
+	LocalPath  string
+	RemotePath string
+	Size       int64
+	Time       time.Time // modification time of the source file
+	Reason     string
+	Err        error
+}
+
+func (item *SyncItem) String() string {
+	s := fmt.Sprintf("%s %s", item.Action, item.Path)
+	if item.Reason != "" {
+		s += " (" + item.Reason + ")"
+	}
+	if item.Err != nil {
+		s += ": " + item.Err.Error()
+	}
+	return s
+}
+
+type SyncPlan struct {
+	Items []*SyncItem
+	// Skipped: number of files already in sync
+	Skipped int
+}
+
+// SyncReport summarizes an executed or dry-run sync.
+type SyncReport struct {
+	Items    []*SyncItem
+	Count    map[SyncAction]int // succeeded actions
+	Skipped  int
+	Failed   int
+	Bytes    int64
+	DryRun   bool
+	Duration time.Duration
+}
+
+func (r *SyncReport) String() string {
+	actions := []SyncAction{}
+	for action := range r.Count {
+		actions = append(actions, action)
+	}
+	sort.Slice(actions, func(i, j int) bool { return actions[i] < actions[j] })
+
+	parts := []string{}
+	for _, action := range actions {
+		parts = append(parts, fmt.Sprintf("%s %d", action, r.Count[action]))
+	}
+	parts = append(parts,
+		fmt.Sprintf("skipped %d", r.Skipped),
+		fmt.Sprintf("failed %d", r.Failed),
+		fmt.Sprintf("%d bytes in %s", r.Bytes, r.Duration.Round(time.Millisecond)))
+	s := strings.Join(parts, ", ")
+	if r.DryRun {
+		s = "dry run: " + s
+	}
+	return s
+}
+
+func matchSyncPattern(pattern, name string) bool {
+	if !strings.Contains(pattern, "/") {
+		name = path.Base(name)
+	}
+	ok, _ := path.Match(pattern, name)
+	return ok
+}
+
+// syncFiltered reports whether name is left out by the include and exclude
+// patterns.
+func syncFiltered(include, exclude []string, name string) bool {
+	for _, pattern := range exclude {
+		if matchSyncPattern(pattern, name) {
+			return true
+		}
+	}
+	for _, pattern := range include {
+		if matchSyncPattern(pattern, name) {
+			return false
+		}
+	}
+	return len(include) > 0
+}
+
+// Sync uploads the files of config.LocalDir which are new or changed to
+// config.RemoteDir.
+func (up *UpYun) Sync(config *SyncConfig) (*SyncReport, error) {
+	return up.SyncContext(context.Background(), config)
+}
+
+func (up *UpYun) SyncContext(ctx context.Context, config *SyncConfig) (*SyncReport, error) {
+	plan, err := up.PlanSyncContext(ctx, config)
+	if err != nil {
+		return nil, err
+	}
+	return up.ExecuteSyncContext(ctx, config, plan)
+}
+
+// PlanSync compares config.LocalDir with config.RemoteDir without changing
+// anything.
+func (up *UpYun) PlanSync(config *SyncConfig) (*SyncPlan, error) {
+	return up.PlanSyncContext(context.Background(), config)
+}
+
+func (up *UpYun) PlanSyncContext(ctx context.Context, config *SyncConfig) (*SyncPlan, error) {
+	remotes, err := up.listSyncRemote(ctx, config.RemoteDir, config.Include, config.Exclude)
+	if err != nil {
+		return nil, err
+	}
+
+	locals, err := listSyncLocal(config.LocalDir, config.Include, config.Exclude)
+	if err != nil {
+		return nil, err
+	}
+
+	plan := &SyncPlan{}
+	for rel, info := range locals {
+		item := &SyncItem{
+			Action:     SyncUpload,
+			Path:       rel,
+			LocalPath:  filepath.Join(config.LocalDir, filepath.FromSlash(rel)),
+			RemotePath: path.Join(config.RemoteDir, rel),
+			Size:       info.Size(),
+			Time:       info.ModTime(),
+		}
+		remote, ok := remotes[rel]
+		delete(remotes, rel)
+		if ok {
+			item.Action = SyncOverwrite
+			item.Reason, err = up.syncDiff(ctx, config.UseMD5, item.LocalPath, info, item.RemotePath, remote)
+			if err != nil {
+				return nil, err
+			}
+			if item.Reason == "" {
+				plan.Skipped++
+				continue
+			}
+		}
+		plan.Items = append(plan.Items, item)
+	}
+
+	if config.Delete {
+		for rel, remote := range remotes {
+			plan.Items = append(plan.Items, &SyncItem{
+				Action:     SyncDelete,
+				Path:       rel,
+				LocalPath:  filepath.Join(config.LocalDir, filepath.FromSlash(rel)),
+				RemotePath: path.Join(config.RemoteDir, rel),
+				Size:       remote.Size,
+				Time:       remote.Time,
+			})
+		}
+	}
+	sortSyncPlan(plan)
+	return plan, nil
+}
+
+func sortSyncPlan(plan *SyncPlan) {
+	sort.Slice(plan.Items, func(i, j int) bool {
+		return plan.Items[i].Path < plan.Items[j].Path
+	})
+}
+
+// listSyncLocal returns the regular files under dir by slash separated
+// relative path.
+func listSyncLocal(dir string, include, exclude []string) (map[string]fs.FileInfo, error) {
+	locals := make(map[string]fs.FileInfo)
+	err := filepath.WalkDir(dir, func(localPath string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || !d.Type().IsRegular() {
+			return nil
+		}
+		rel, err := filepath.Rel(dir, localPath)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		if syncFiltered(include, exclude, rel) {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		locals[rel] = info
+		return nil
+	})
+	if err != nil {
+		return nil, errorOperation("sync walk local", err)
+	}
+	return locals, nil
+}
+
+// listSyncRemote returns the remote files under dir by relative path.
+func (up *UpYun) listSyncRemote(ctx context.Context, dir string, include, exclude []string) (map[string]*FileInfo, error) {
+	remotes := make(map[string]*FileInfo)
+	it := up.ObjectsContext(ctx, dir, &ObjectsConfig{MaxListLevel: -1, Limit: MaxLimit})
+	for it.Next() {
+		fInfo := it.Object()
+		if !fInfo.IsDir && !syncFiltered(include, exclude, fInfo.Name) {
+			remotes[fInfo.Name] = fInfo
+		}
+	}
+	if err := it.Err(); err != nil && !IsNotExist(err) {
+		return nil, err
+	}
+	return remotes, nil
+}
+
+// syncDiff returns why the local file differs from the remote one, or ""
+// if they are the same.
+func (up *UpYun) syncDiff(ctx context.Context, useMD5 bool, localPath string, info fs.FileInfo,
+	remotePath string, remote *FileInfo) (string, error) {
+	if info.Size() != remote.Size {
+		return "size", nil
+	}
+	if !useMD5 {
+		mtime, err := up.syncRemoteMtime(ctx, remotePath, remote)
+		if err != nil {
+			return "", err
+		}
+		if mtime != "" {
+			if mtime != strconv.FormatInt(info.ModTime().UnixNano(), 10) {
+				return "modified", nil
+			}
+			return "", nil
+		}
+		// not uploaded by Sync, remote times have a precision of one second
+		if info.ModTime().Truncate(time.Second).After(remote.Time.Truncate(time.Second)) {
+			return "modified", nil
+		}
+		return "", nil
+	}
+
+	remoteMD5 := remote.MD5
+	if remoteMD5 == "" {
+		fInfo, err := up.GetInfoContext(ctx, remotePath)
+		if err != nil {
+			return "", err
+		}
+		remoteMD5 = fInfo.MD5
+	}
+	fd, err := os.Open(localPath)
+	if err != nil {
+		return "", err
+	}
+	defer fd.Close()
+	localMD5, err := md5File(fd)
+	if err != nil {
+		return "", err
+	}
+	if localMD5 != remoteMD5 {
+		return "md5", nil
+	}
+	return "", nil
+}
+
+// syncRemoteMtime returns the modification time stored by Sync with the
+// remote file, which listings do not report.
+func (up *UpYun) syncRemoteMtime(ctx context.Context, remotePath string, remote *FileInfo) (string, error) {
+	if remote.Meta == nil {
+		fInfo, err := up.GetInfoContext(ctx, remotePath)
+		if err != nil {
+			return "", err
+		}
+		remote.Meta = fInfo.Meta
+	}
+	return remote.Meta[syncMtimeMeta], nil
+}
+
+// ExecuteSync carries out plan, actions which fail are reported in their
+// items and counted in the returned error.
+func (up *UpYun) ExecuteSync(config *SyncConfig, plan *SyncPlan) (*SyncReport, error) {
+	return up.ExecuteSyncContext(context.Background(), config, plan)
+}
+
+func (up *UpYun) ExecuteSyncContext(ctx context.Context, config *SyncConfig, plan *SyncPlan) (*SyncReport, error) {
+	return runSyncPlan(ctx, config.Concurrency, config.DryRun, config.Output, plan, func(item *SyncItem) error {
+		switch item.Action {
+		case SyncUpload, SyncOverwrite:
+			mtime := strconv.FormatInt(item.Time.UnixNano(), 10)
+			resume := item.Size >= minResumePutFileSize
+			err := up.PutContext(ctx, &PutObjectConfig{
+				Path:            item.RemotePath,
+				LocalPath:       item.LocalPath,
+				Headers:         map[string]string{syncMtimeMeta: mtime},
+				UseMD5:          config.UseMD5,
+				UseResumeUpload: resume,
+			})
+			if err != nil || !resume {
+				return err
+			}
+			// multipart uploads do not carry metadata
+			return up.ModifyMetadataContext(ctx, &ModifyMetadataConfig{
+				Path:    item.RemotePath,
+				Headers: map[string]string{syncMtimeMeta: mtime},
+			})
+		case SyncDelete:
+			return up.DeleteContext(ctx, &DeleteObjectConfig{Path: item.RemotePath})
+		}
+		return fmt.Errorf("unknown sync action %s", item.Action)
+	})
+}
+
+// runSyncPlan executes the items of plan by a pool of workers.
+func runSyncPlan(ctx context.Context, concurrency int, dryRun bool, output io.Writer,
+	plan *SyncPlan, execute func(item *SyncItem) error) (*SyncReport, error) {
+	start := time.Now()
+	report := &SyncReport{
+		Items:   plan.Items,
+		Count:   make(map[SyncAction]int),
+		Skipped: plan.Skipped,
+		DryRun:  dryRun,
+	}
+	if dryRun {
+		for _, item := range plan.Items {
+			if output != nil {
+				fmt.Fprintln(output, item)
+			}
+			report.Count[item.Action]++
+		}
+		report.Duration = time.Since(start)
+		return report, nil
+	}
+
+	if concurrency <= 0 {
+		concurrency = defaultSyncConcurrency
+	}
+	var (
+		wg sync.WaitGroup
+		mu sync.Mutex
+	)
+	items := make(chan *SyncItem)
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for item := range items {
+				if item.Err = ctx.Err(); item.Err == nil {
+					item.Err = execute(item)
+				}
+
+				mu.Lock()
+				if item.Err != nil {
+					report.Failed++
+				} else {
+					report.Count[item.Action]++
+					if item.Action.transfers() {
+						report.Bytes += item.Size
+					}
+				}
+				if output != nil {
+					fmt.Fprintln(output, item)
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+	for _, item := range plan.Items {
+		items <- item
+	}
+	close(items)
+	wg.Wait()
+
+	report.Duration = time.Since(start)
+	if report.Failed > 0 {
+		return report, fmt.Errorf("sync: %d of %d actions failed", report.Failed, len(plan.Items))
+	}
+	return report, nil
+}
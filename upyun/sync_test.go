@@ -0,0 +1,57 @@
+package upyun
+
+import (
+	"bytes"
+	"os"
+	"path"
+	"path/filepath"
+	"testing"
+)
+
+func TestSync(t *testing.T) {
+	localDir := TempLocalDir(t)
+	defer os.RemoveAll(localDir)
+	remoteDir := path.Join(ROOT, "SYNC")
+
+	os.MkdirAll(filepath.Join(localDir, "sub"), 0755)
+	os.WriteFile(filepath.Join(localDir, "a.txt"), []byte("a"), 0644)
+	os.WriteFile(filepath.Join(localDir, "sub", "b.txt"), []byte("b"), 0644)
+	os.WriteFile(filepath.Join(localDir, "c.log"), []byte("c"), 0644)
+
+	config := &SyncConfig{
+		LocalDir:  localDir,
+		RemoteDir: remoteDir,
+		Delete:    true,
+		UseMD5:    true,
+		Exclude:   []string{"*.log"},
+	}
+	out := &bytes.Buffer{}
+	config.DryRun, config.Output = true, out
+	report, err := up.Sync(config)
+	Nil(t, err)
+	Equal(t, report.Count[SyncUpload], 2)
+	Equal(t, out.String(), "upload a.txt\nupload sub/b.txt\n")
+	_, err = up.GetInfo(path.Join(remoteDir, "a.txt"))
+	Equal(t, IsNotExist(err), true)
+
+	config.DryRun, config.Output = false, nil
+	report, err = up.Sync(config)
+	Nil(t, err)
+	Equal(t, report.Count[SyncUpload], 2)
+
+	os.WriteFile(filepath.Join(localDir, "a.txt"), []byte("aa"), 0644)
+	os.Remove(filepath.Join(localDir, "sub", "b.txt"))
+	report, err = up.Sync(config)
+	Nil(t, err)
+	Equal(t, report.Count[SyncOverwrite], 1)
+	Equal(t, report.Count[SyncDelete], 1)
+	Equal(t, report.Skipped, 0)
+
+	report, err = up.Sync(config)
+	Nil(t, err)
+	Equal(t, len(report.Items), 0)
+	Equal(t, report.Skipped, 1)
+
+	err = up.Delete(&DeleteObjectConfig{Path: path.Join(remoteDir, "a.txt")})
+	Nil(t, err)
+}
@@ -21,6 +21,18 @@ type UpYunConfig struct {
 	Hosts     map[string]string
 	UserAgent string
 	UseHTTP   bool
+	// RetryPolicy retries failed requests whose body can be rewound,
+	// nil means no retry.
+	RetryPolicy RetryPolicy
+	// UploadLimit and DownloadLimit cap the bytes per second sent and
+	// received, RequestLimit caps the requests per second. Nil means no
+	// limit, a limiter shared by several UpYun limits them together.
+	UploadLimit   *RateLimiter
+	DownloadLimit *RateLimiter
+	RequestLimit  *RateLimiter
+	// Credentials, if set, provides the operator, password and secret at
+	// signing time instead of the fields above.
+	Credentials CredentialsProvider
 }
 
 type UpYun struct {
@@ -28,7 +40,8 @@ type UpYun struct {
 	httpc      *http.Client
 	deprecated bool
 	Recorder
-	stopChan chan struct{}
+	downloadRecorder DownloadRecorder
+	stopChan         chan struct{}
 }
 
 func NewUpYun(config *UpYunConfig) *UpYun {
@@ -39,6 +52,11 @@ func NewUpYun(config *UpYunConfig) *UpYun {
 	up.Secret = config.Secret
 	up.Hosts = config.Hosts
 	up.UseHTTP = config.UseHTTP
+	up.RetryPolicy = config.RetryPolicy
+	up.UploadLimit = config.UploadLimit
+	up.DownloadLimit = config.DownloadLimit
+	up.RequestLimit = config.RequestLimit
+	up.Credentials = config.Credentials
 	if config.UserAgent != "" {
 		up.UserAgent = config.UserAgent
 	} else {
@@ -67,13 +85,28 @@ func (up *UpYun) UseDeprecatedApi() {
 func (up *UpYun) SetRecorder(recoder Recorder) {
 	if recoder != nil {
 		up.Recorder = recoder
-		up.SetTimedTask(up.Recorder.TimedClearance)
+		up.setTimedTask(up.Recorder.TimedClearance, recordTTL(recoder))
 	}
 	up.stopChan = make(chan struct{})
 }
 
+func (up *UpYun) SetDownloadRecorder(recorder DownloadRecorder) {
+	if up.stopChan == nil {
+		up.stopChan = make(chan struct{})
+	}
+	if recorder != nil {
+		up.downloadRecorder = recorder
+		up.setTimedTask(recorder.TimedClearance, recordTTL(recorder))
+	}
+}
+
+// SetTimedTask runs task every 24h until Close.
 func (up *UpYun) SetTimedTask(task func()) {
-	t := time.NewTicker(24 * time.Hour)
+	up.setTimedTask(task, defaultRecordTTL)
+}
+
+func (up *UpYun) setTimedTask(task func(), interval time.Duration) {
+	t := time.NewTicker(interval)
 	go func(t *time.Ticker) {
 		defer t.Stop()
 		for {
@@ -0,0 +1,169 @@
+package upyuntest
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"path"
+	"strconv"
+	"time"
+)
+
+// Fault describes a failure the server injects into the requests it
+// matches. The zero values of Method, Path and Stage match any request.
+//
+//	// the 2nd and 3rd part uploads are rejected
+//	srv.AddFault(upyuntest.Fault{Stage: "upload", Skip: 1, Count: 2, Status: 503})
+//
+// Delay is applied first, then the response is replaced by Status, or
+// damaged by Drop or Truncate.
+type Fault struct {
+	Method string
+	// Path is a path.Match pattern of the path without the bucket
+	Path string
+	// Stage matches the X-Upyun-Multi-Stage header, "upload" for parts
+	Stage string
+
+	// Skip lets the first Skip matching requests through
+	Skip int
+	// Count is the number of requests failed, 0 for every matching one
+	Count int
+
+	// Delay: wait before handling the request, until the client gives up
+	Delay time.Duration
+	// Status replaces the response by an error of this status
+	Status int
+	// RetryAfter is sent with Status
+	RetryAfter time.Duration
+	// Drop closes the connection in the middle of the response body, or
+	// before the response if it has no body
+	Drop bool
+	// Truncate cuts list pages short: half of their items are served with
+	// the iter of the others, as a server giving up on a page does. Other
+	// response bodies are cut in half, with a matching Content-Length.
+	Truncate bool
+
+	seen int
+}
+
+func (f *Fault) match(r *http.Request, p string) bool {
+	if f.Method != "" && f.Method != r.Method {
+		return false
+	}
+	if f.Path != "" {
+		if ok, _ := path.Match(f.Path, p); !ok {
+			return false
+		}
+	}
+	if f.Stage != "" && f.Stage != r.Header.Get("X-Upyun-Multi-Stage") {
+		return false
+	}
+
+	f.seen++
+	return f.seen > f.Skip && (f.Count == 0 || f.seen <= f.Skip+f.Count)
+}
+
+// AddFault injects f into the requests made from now on. Faults are matched
+// in the order they are added, each request gets the first one which fires.
+func (s *Server) AddFault(f Fault) {
+	s.mu.Lock()
+	s.faults = append(s.faults, &f)
+	s.mu.Unlock()
+}
+
+// ClearFaults removes all faults.
+func (s *Server) ClearFaults() {
+	s.mu.Lock()
+	s.faults = nil
+	s.mu.Unlock()
+}
+
+func (s *Server) matchFault(r *http.Request, p string) *Fault {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, f := range s.faults {
+		if f.match(r, p) {
+			return f
+		}
+	}
+	return nil
+}
+
+// serveFault serves r with fault f applied, handle serves it normally.
+func serveFault(w http.ResponseWriter, r *http.Request, f *Fault, handle http.HandlerFunc) {
+	if f.Delay > 0 {
+		t := time.NewTimer(f.Delay)
+		defer t.Stop()
+		select {
+		case <-t.C:
+		case <-r.Context().Done():
+			return
+		}
+	}
+
+	if f.Status != 0 {
+		if f.RetryAfter > 0 {
+			secs := int((f.RetryAfter + time.Second - 1) / time.Second)
+			w.Header().Set("Retry-After", strconv.Itoa(secs))
+		}
+		writeError(w, f.Status, f.Status*100000+99, "injected fault")
+		return
+	}
+	if !f.Drop && !f.Truncate {
+		handle(w, r)
+		return
+	}
+
+	short := false
+	if f.Truncate {
+		r = r.WithContext(context.WithValue(r.Context(), shortPageKey{}, &short))
+	}
+	rec := httptest.NewRecorder()
+	handle(rec, r)
+	body := rec.Body.Bytes()
+	if short {
+		for k, v := range rec.Header() {
+			w.Header()[k] = v
+		}
+		w.WriteHeader(rec.Code)
+		w.Write(body)
+		return
+	}
+	if f.Drop && len(body) == 0 {
+		panic(http.ErrAbortHandler)
+	}
+
+	for k, v := range rec.Header() {
+		w.Header()[k] = v
+	}
+	half := body[:len(body)/2]
+	length := len(body)
+	if f.Truncate {
+		length = len(half)
+	}
+	if length > 0 {
+		w.Header().Set("Content-Length", strconv.Itoa(length))
+	}
+	w.WriteHeader(rec.Code)
+	w.Write(half)
+	if f.Drop {
+		if flusher, ok := w.(http.Flusher); ok {
+			flusher.Flush()
+		}
+		// the server closes the connection without finishing the response
+		panic(http.ErrAbortHandler)
+	}
+}
+
+type shortPageKey struct{}
+
+// shortPage returns how many of n items a list page of r serves, half of
+// them rounded up if a Truncate fault cuts the page short.
+func shortPage(r *http.Request, n int) int {
+	short, _ := r.Context().Value(shortPageKey{}).(*bool)
+	if short == nil {
+		return n
+	}
+	*short = true
+	return (n + 1) / 2
+}
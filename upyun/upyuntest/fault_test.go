@@ -0,0 +1,211 @@
+package upyuntest
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/upyun/go-sdk/v3/upyun"
+)
+
+func TestFaultStatus(t *testing.T) {
+	srv, up := newTestServer(t)
+	srv.AddFault(Fault{Method: "PUT", Path: "/limited/*", Count: 1, Status: 429, RetryAfter: time.Second})
+
+	err := up.Put(&upyun.PutObjectConfig{Path: "/limited/a", Reader: strings.NewReader("a")})
+	if !upyun.IsTooManyRequests(err) || err.(*upyun.Error).Header.Get("Retry-After") != "1" {
+		t.Fatalf("err = %v", err)
+	}
+	if err = up.Put(&upyun.PutObjectConfig{Path: "/limited/a", Reader: strings.NewReader("a")}); err != nil {
+		t.Fatal(err)
+	}
+
+	// a burst of 5xx outlasted by retries
+	srv.AddFault(Fault{Path: "/burst", Count: 2, Status: 503})
+	config := srv.Config()
+	config.RetryPolicy = &upyun.ExponentialBackoff{MaxAttempts: 3, BaseDelay: time.Millisecond}
+	up = upyun.NewUpYun(config)
+	if err = up.Put(&upyun.PutObjectConfig{Path: "/burst", Reader: strings.NewReader("b")}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestFaultBody(t *testing.T) {
+	srv, up := newTestServer(t)
+	srv.PutObject("/file", bytes.Repeat([]byte("x"), 1000))
+	for i := 0; i < 5; i++ {
+		srv.PutObject("/dir/"+string(rune('a'+i)), []byte("x"))
+	}
+
+	srv.AddFault(Fault{Method: "GET", Path: "/file", Skip: 1, Count: 1, Drop: true})
+	get := func() error {
+		_, err := up.Get(&upyun.GetObjectConfig{Path: "/file", Writer: &bytes.Buffer{}})
+		return err
+	}
+	if err := get(); err != nil {
+		t.Fatal(err)
+	}
+	if err := get(); err == nil {
+		t.Fatal("dropped connection not reported")
+	}
+	if err := get(); err != nil {
+		t.Fatal(err)
+	}
+
+	srv.AddFault(Fault{Method: "GET", Path: "/dir", Count: 1, Truncate: true})
+	files, iter, err := up.ListObjects(&upyun.ListObjectsConfig{Path: "/dir"})
+	if err != nil || len(files) != 3 || iter == "" {
+		t.Fatalf("short page: files = %d, iter = %q, %v", len(files), iter, err)
+	}
+	files, _, err = up.ListObjects(&upyun.ListObjectsConfig{Path: "/dir"})
+	if err != nil || len(files) != 5 {
+		t.Fatalf("files = %d, %v", len(files), err)
+	}
+}
+
+func TestFaultTruncateIterators(t *testing.T) {
+	srv, up := newTestServer(t)
+	for i := 0; i < 5; i++ {
+		srv.PutObject(fmt.Sprintf("/dir/%d", i), []byte("x"))
+	}
+	srv.AddFault(Fault{Method: "GET", Path: "/dir", Count: 1, Truncate: true})
+	it := up.Objects("/dir", &upyun.ObjectsConfig{})
+	n := 0
+	for it.Next() {
+		n++
+	}
+	if it.Err() != nil || n != 5 {
+		t.Fatalf("objects = %d, %v", n, it.Err())
+	}
+
+	init, err := up.InitMultipartUpload(&upyun.InitMultipartUploadConfig{
+		Path:     "/stale",
+		PartSize: upyun.DefaultPartSize,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for id := 0; id < 4; id++ {
+		err = up.UploadPart(init, &upyun.UploadPartConfig{
+			PartID:   id,
+			PartSize: upyun.DefaultPartSize,
+			Reader:   bytes.NewReader(make([]byte, upyun.DefaultPartSize)),
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	srv.AddFault(Fault{Method: "GET", Path: "/stale", Count: 1, Truncate: true})
+	stale, err := up.CleanMultipartUploads(&upyun.CleanMultipartConfig{MaxAge: time.Nanosecond, DryRun: true})
+	if err != nil || len(stale) != 1 || stale[0].Parts != 4 {
+		t.Fatalf("stale = %v, %v", stale, err)
+	}
+}
+
+func TestFaultDelay(t *testing.T) {
+	srv, up := newTestServer(t)
+	srv.AddFault(Fault{Method: "HEAD", Delay: time.Minute})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := up.GetInfoContext(ctx, "/"); err == nil {
+		t.Fatal("slow response not timed out")
+	}
+	srv.ClearFaults()
+	if _, err := up.GetInfo("/"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestFaultRejectPart(t *testing.T) {
+	for _, concurrency := range []int{1, 4} {
+		srv, up := newTestServer(t)
+		srv.AddFault(Fault{Stage: "upload", Skip: 2, Count: 2, Status: 503})
+
+		data := make([]byte, 10*upyun.DefaultPartSize+1)
+		rand.Read(data)
+		name := filepath.Join(t.TempDir(), "big")
+		if err := os.WriteFile(name, data, 0644); err != nil {
+			t.Fatal(err)
+		}
+		err := up.Put(&upyun.PutObjectConfig{
+			Path:              "/big",
+			LocalPath:         name,
+			UseResumeUpload:   true,
+			ResumeConcurrency: concurrency,
+			MaxResumePutTries: 3,
+		})
+		if err != nil {
+			t.Fatalf("concurrency %d: %v", concurrency, err)
+		}
+		if b, _ := srv.Object("/big"); !bytes.Equal(b, data) {
+			t.Fatalf("concurrency %d: content mismatch", concurrency)
+		}
+	}
+}
+
+func TestFaultRejectPartNotRetried(t *testing.T) {
+	for _, concurrency := range []int{1, 4} {
+		srv, up := newTestServer(t)
+		srv.AddFault(Fault{Stage: "upload", Skip: 2, Count: 1, Status: 400})
+
+		data := make([]byte, 10*upyun.DefaultPartSize+1)
+		rand.Read(data)
+		name := filepath.Join(t.TempDir(), "big")
+		if err := os.WriteFile(name, data, 0644); err != nil {
+			t.Fatal(err)
+		}
+		err := up.Put(&upyun.PutObjectConfig{
+			Path:              "/big",
+			LocalPath:         name,
+			UseResumeUpload:   true,
+			ResumeConcurrency: concurrency,
+		})
+		if err == nil {
+			t.Fatalf("concurrency %d: rejected part retried", concurrency)
+		}
+		if _, ok := srv.Object("/big"); ok {
+			t.Fatalf("concurrency %d: object completed", concurrency)
+		}
+	}
+}
+
+func TestFaultResumeGet(t *testing.T) {
+	srv, up := newTestServer(t)
+	data := make([]byte, 3*upyun.DefaultPartSize+1)
+	rand.Read(data)
+	srv.PutObject("/big", data)
+
+	srv.AddFault(Fault{Method: "GET", Path: "/big", Skip: 1, Count: 2, Status: 503})
+	name := filepath.Join(t.TempDir(), "big")
+	_, err := up.Get(&upyun.GetObjectConfig{
+		Path:              "/big",
+		LocalPath:         name,
+		UseResumeDownload: true,
+		ResumePartSize:    upyun.DefaultPartSize,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b, _ := os.ReadFile(name); !bytes.Equal(b, data) {
+		t.Fatal("content mismatch")
+	}
+
+	srv.AddFault(Fault{Method: "GET", Path: "/big", Skip: 1, Count: 1, Status: 403})
+	name = filepath.Join(t.TempDir(), "big")
+	_, err = up.Get(&upyun.GetObjectConfig{
+		Path:              "/big",
+		LocalPath:         name,
+		UseResumeDownload: true,
+		ResumePartSize:    upyun.DefaultPartSize,
+	})
+	if ae, ok := err.(*upyun.Error); !ok || ae.StatusCode != 403 {
+		t.Fatalf("forbidden part retried: %v", err)
+	}
+}
@@ -0,0 +1,297 @@
+package upyuntest
+
+import (
+	"crypto/md5"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type upload struct {
+	id          string
+	path        string
+	contentType string
+	partSize    int64
+	length      int64 // 0 if unknown
+	disorder    bool
+	parts       map[int]*part
+	created     time.Time
+}
+
+type part struct {
+	data     []byte
+	modified time.Time
+}
+
+// nextPart returns the first missing part of an ordered upload.
+func (u *upload) nextPart() int {
+	id := 0
+	for u.parts[id] != nil {
+		id++
+	}
+	return id
+}
+
+// nextPartSize is the size of the next part of an ordered upload, the last
+// one may be shorter, and 0 for disorder uploads.
+func (u *upload) nextPartSize() int64 {
+	if u.disorder {
+		return 0
+	}
+	size := u.length - int64(u.nextPart())*u.partSize
+	if size > u.partSize {
+		size = u.partSize
+	}
+	if size < 0 {
+		size = 0
+	}
+	return size
+}
+
+func (u *upload) partIDs() []int {
+	ids := make([]int, 0, len(u.parts))
+	for id := range u.parts {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+	return ids
+}
+
+func (s *Server) serveMultipart(w http.ResponseWriter, r *http.Request, p string) {
+	stage := r.Header.Get("X-Upyun-Multi-Stage")
+	if stage == "initiate" {
+		s.serveInitiate(w, r, p)
+		return
+	}
+
+	u, ok := s.uploads[r.Header.Get("X-Upyun-Multi-Uuid")]
+	if !ok || u.path != p {
+		writeError(w, http.StatusNotFound, 40011059, "upload not found")
+		return
+	}
+	switch stage {
+	case "upload":
+		s.serveUploadPart(w, r, u)
+	case "complete":
+		s.serveComplete(w, r, u)
+	default:
+		writeError(w, http.StatusBadRequest, 40011050, "invalid multi stage")
+	}
+}
+
+func (s *Server) serveInitiate(w http.ResponseWriter, r *http.Request, p string) {
+	partSize, err := strconv.ParseInt(r.Header.Get("X-Upyun-Multi-Part-Size"), 10, 64)
+	if err != nil || partSize <= 0 {
+		writeError(w, http.StatusBadRequest, 40011051, "invalid part size")
+		return
+	}
+	var length int64
+	if v := r.Header.Get("X-Upyun-Multi-Length"); v != "" {
+		if length, err = strconv.ParseInt(v, 10, 64); err != nil || length < 0 {
+			writeError(w, http.StatusBadRequest, 40011052, "invalid length")
+			return
+		}
+	}
+
+	s.nextID++
+	u := &upload{
+		id:          fmt.Sprintf("%08x-upyuntest", s.nextID),
+		path:        p,
+		contentType: r.Header.Get("X-Upyun-Multi-Type"),
+		partSize:    partSize,
+		length:      length,
+		disorder:    r.Header.Get("X-Upyun-Multi-Disorder") == "true",
+		parts:       make(map[int]*part),
+		created:     time.Now(),
+	}
+	s.uploads[u.id] = u
+	w.Header().Set("X-Upyun-Multi-Uuid", u.id)
+	w.Header().Set("X-Upyun-Next-Part-Id", "0")
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) serveUploadPart(w http.ResponseWriter, r *http.Request, u *upload) {
+	id, err := strconv.Atoi(r.Header.Get("X-Upyun-Part-Id"))
+	if err != nil || id < 0 {
+		writeError(w, http.StatusBadRequest, 40011053, "invalid part id")
+		return
+	}
+	if !u.disorder && id > u.nextPart() {
+		writeError(w, http.StatusBadRequest, 40011054, "part id out of order")
+		return
+	}
+	data, err := io.ReadAll(r.Body)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, 40000002, err.Error())
+		return
+	}
+	if int64(len(data)) > u.partSize || (r.ContentLength >= 0 && int64(len(data)) != r.ContentLength) {
+		writeError(w, http.StatusBadRequest, 40011055, "invalid part size")
+		return
+	}
+
+	u.parts[id] = &part{data: data, modified: time.Now()}
+	w.Header().Set("X-Upyun-Next-Part-Id", strconv.Itoa(u.nextPart()))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) serveComplete(w http.ResponseWriter, r *http.Request, u *upload) {
+	var data []byte
+	ids := u.partIDs()
+	for i, id := range ids {
+		pt := u.parts[id]
+		if id != i || (i < len(ids)-1 && int64(len(pt.data)) != u.partSize) {
+			writeError(w, http.StatusBadRequest, 40011056, "parts are not continuous")
+			return
+		}
+		data = append(data, pt.data...)
+	}
+	if u.length > 0 && int64(len(data)) != u.length {
+		writeError(w, http.StatusBadRequest, 40011057, "length mismatch")
+		return
+	}
+	sum := fmt.Sprintf("%x", md5.Sum(data))
+	if md5 := r.Header.Get("X-Upyun-Multi-Md5"); md5 != "" && md5 != sum {
+		writeError(w, http.StatusBadRequest, 40011058, "md5 mismatch")
+		return
+	}
+
+	obj := &object{
+		data:        data,
+		contentType: u.contentType,
+		meta:        metaHeaders(r.Header),
+		modified:    time.Now(),
+	}
+	if obj.contentType == "" {
+		obj.contentType = "application/octet-stream"
+	}
+	s.putObject(u.path, obj)
+	delete(s.uploads, u.id)
+	w.Header().Set("ETag", "\""+sum+"\"")
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// latestUpload returns the most recent unfinished upload to p.
+func (s *Server) latestUpload(p string) *upload {
+	var latest *upload
+	for _, u := range s.uploads {
+		if u.path == p && (latest == nil || u.created.After(latest.created) ||
+			u.created.Equal(latest.created) && u.id > latest.id) {
+			latest = u
+		}
+	}
+	return latest
+}
+
+func (s *Server) serveResumeProcess(w http.ResponseWriter, p string) {
+	u := s.latestUpload(p)
+	if u == nil {
+		writeError(w, http.StatusNotFound, 40400001, "upload not found")
+		return
+	}
+	w.Header().Set("X-Upyun-Multi-Uuid", u.id)
+	w.Header().Set("X-Upyun-Next-Part-Id", strconv.Itoa(u.nextPart()))
+	w.Header().Set("X-Upyun-Next-Part-Size", strconv.FormatInt(u.nextPartSize(), 10))
+	w.Header().Set("X-Upyun-Multi-Length", strconv.FormatInt(u.length, 10))
+	w.Header().Set("X-Upyun-Meta-Order", strconv.FormatBool(!u.disorder))
+	w.Header().Set("X-Upyun-Created-Date", u.created.UTC().Format(http.TimeFormat))
+	if !u.disorder {
+		return
+	}
+	parts := []map[string]interface{}{}
+	for _, id := range u.partIDs() {
+		pt := u.parts[id]
+		parts = append(parts, map[string]interface{}{
+			"id":            id,
+			"size":          len(pt.data),
+			"last_modified": pt.modified.Unix(),
+			"etag":          fmt.Sprintf("%x", md5.Sum(pt.data)),
+		})
+	}
+	writeJSON(w, map[string]interface{}{"parts": parts})
+}
+
+func (s *Server) serveListParts(w http.ResponseWriter, r *http.Request, p string) {
+	u, ok := s.uploads[r.Header.Get("X-Upyun-Multi-Uuid")]
+	if !ok || u.path != p {
+		writeError(w, http.StatusNotFound, 40011059, "upload not found")
+		return
+	}
+	begin, _ := strconv.Atoi(r.Header.Get("X-Upyun-Part-Id"))
+	parts := []map[string]interface{}{}
+	for _, id := range u.partIDs() {
+		if id < begin {
+			continue
+		}
+		pt := u.parts[id]
+		parts = append(parts, map[string]interface{}{
+			"id":   id,
+			"size": len(pt.data),
+			"etag": fmt.Sprintf("%x", md5.Sum(pt.data)),
+		})
+	}
+	// the client asks for the parts after the last one it got
+	writeJSON(w, map[string]interface{}{"parts": parts[:shortPage(r, len(parts))]})
+}
+
+func (s *Server) serveListUploads(w http.ResponseWriter, r *http.Request) {
+	prefix := ""
+	if v := r.Header.Get("X-Upyun-List-Prefix"); v != "" {
+		b, err := base64.StdEncoding.DecodeString(v)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, 40000008, "invalid prefix")
+			return
+		}
+		prefix = string(b)
+	}
+	limit := defaultLimit
+	if n, err := strconv.Atoi(r.Header.Get("X-Upyun-List-Limit")); err == nil && n > 0 {
+		limit = n
+	}
+
+	uploads := []*upload{}
+	for _, u := range s.uploads {
+		if strings.HasPrefix(u.path, prefix) || strings.HasPrefix(strings.TrimPrefix(u.path, "/"), prefix) {
+			uploads = append(uploads, u)
+		}
+	}
+	sort.Slice(uploads, func(i, j int) bool { return uploads[i].id < uploads[j].id })
+
+	start := 0
+	if iter := r.Header.Get("X-Upyun-List-Iter"); iter != "" {
+		b, err := base64.RawURLEncoding.DecodeString(iter)
+		if err == nil {
+			start, err = strconv.Atoi(string(b))
+		}
+		if err != nil || start < 0 || start > len(uploads) {
+			writeError(w, http.StatusBadRequest, 40000001, "invalid iter")
+			return
+		}
+	}
+	end := start + limit
+	if end > len(uploads) {
+		end = len(uploads)
+	}
+	end = start + shortPage(r, end-start)
+	iter := base64.RawURLEncoding.EncodeToString([]byte(strconv.Itoa(end)))
+	if end >= len(uploads) {
+		iter = listEndIter
+	}
+	uploads = uploads[start:end]
+
+	files := []map[string]interface{}{}
+	for _, u := range uploads {
+		files = append(files, map[string]interface{}{
+			"key":        u.path,
+			"uuid":       u.id,
+			"completed":  false,
+			"created_at": u.created.Unix(),
+		})
+	}
+	writeJSON(w, map[string]interface{}{"files": files, "iter": iter})
+}
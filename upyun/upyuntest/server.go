@@ -0,0 +1,470 @@
+// Package upyuntest provides an in-process fake of the UpYun REST storage
+// API for tests which can not reach the real service.
+//
+//	srv := upyuntest.NewServer("bucket", "operator", "password")
+//	defer srv.Close()
+//	up := upyun.NewUpYun(srv.Config())
+//
+// The server keeps objects in memory and checks the signature of every
+// request, as the real service does. Failures of the real service are
+// reproduced by AddFault.
+package upyuntest
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/upyun/go-sdk/v3/upyun"
+)
+
+const (
+	listEndIter  = "g2gCZAAEbmV4dGQAA2VvZg"
+	defaultLimit = 100
+)
+
+// Server is a fake UpYun storage service listening on a local address.
+type Server struct {
+	*httptest.Server
+	Bucket   string
+	Operator string
+	Password string
+
+	verifier *upyun.Verifier
+
+	mu      sync.Mutex
+	objects map[string]*object // by path, without the bucket
+	dirs    map[string]time.Time
+	uploads map[string]*upload // by upload id
+	nextID  int
+	faults  []*Fault
+}
+
+type object struct {
+	data        []byte
+	contentType string
+	meta        map[string]string // lowercase x-upyun-meta-* headers
+	modified    time.Time
+}
+
+// NewServer starts a fake service holding an empty bucket, which accepts the
+// requests signed by operator and password.
+func NewServer(bucket, operator, password string) *Server {
+	s := &Server{
+		Bucket:   bucket,
+		Operator: operator,
+		Password: password,
+		verifier: upyun.NewVerifier(map[string]string{operator: password}),
+		objects:  make(map[string]*object),
+		dirs:     map[string]time.Time{"/": time.Now()},
+		uploads:  make(map[string]*upload),
+	}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serveHTTP))
+	return s
+}
+
+// Config returns a configuration which points an UpYun client to s.
+func (s *Server) Config() *upyun.UpYunConfig {
+	return &upyun.UpYunConfig{
+		Bucket:   s.Bucket,
+		Operator: s.Operator,
+		Password: s.Password,
+		Hosts:    map[string]string{"host": s.Listener.Addr().String()},
+		UseHTTP:  true,
+	}
+}
+
+// Object returns the content of the file at p.
+func (s *Server) Object(p string) ([]byte, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	obj, ok := s.objects[cleanPath(p)]
+	if !ok {
+		return nil, false
+	}
+	return append([]byte(nil), obj.data...), true
+}
+
+// PutObject stores data at p, as if it were uploaded.
+func (s *Server) PutObject(p string, data []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.putObject(cleanPath(p), &object{
+		data:        append([]byte(nil), data...),
+		contentType: "application/octet-stream",
+		meta:        map[string]string{},
+		modified:    time.Now(),
+	})
+}
+
+func cleanPath(p string) string {
+	return path.Join("/", p)
+}
+
+func (s *Server) putObject(p string, obj *object) {
+	s.objects[p] = obj
+	for dir := path.Dir(p); dir != "/"; dir = path.Dir(dir) {
+		if _, ok := s.dirs[dir]; !ok {
+			s.dirs[dir] = obj.modified
+		}
+	}
+}
+
+func (s *Server) isDir(p string) bool {
+	_, ok := s.dirs[p]
+	return ok
+}
+
+// children returns the files and directories right under dir by name.
+func (s *Server) children(dir string) []string {
+	prefix := strings.TrimSuffix(dir, "/") + "/"
+	names := []string{}
+	for p := range s.objects {
+		if path.Dir(p) == dir {
+			names = append(names, strings.TrimPrefix(p, prefix))
+		}
+	}
+	for p := range s.dirs {
+		if p != "/" && path.Dir(p) == dir {
+			names = append(names, strings.TrimPrefix(p, prefix))
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+func writeError(w http.ResponseWriter, status, code int, msg string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"code": code,
+		"msg":  msg,
+		"id":   fmt.Sprintf("upyuntest-%d", time.Now().UnixNano()),
+	})
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
+
+func (s *Server) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	if _, err := s.verifier.Verify(r); err != nil {
+		writeError(w, http.StatusUnauthorized, 40100005, err.Error())
+		return
+	}
+
+	bucketPrefix := "/" + s.Bucket
+	if r.URL.Path != bucketPrefix && !strings.HasPrefix(r.URL.Path, bucketPrefix+"/") {
+		writeError(w, http.StatusNotFound, 40400001, "bucket not found")
+		return
+	}
+	p := cleanPath(strings.TrimPrefix(r.URL.Path, bucketPrefix))
+
+	if f := s.matchFault(r, p); f != nil {
+		serveFault(w, r, f, func(w http.ResponseWriter, r *http.Request) {
+			s.handle(w, r, p)
+		})
+		return
+	}
+	s.handle(w, r, p)
+}
+
+// handle serves r. The request body is read and the response is sent
+// without the lock, which is only held while the response is built from the
+// objects in memory, so that transfers run concurrently.
+func (s *Server) handle(w http.ResponseWriter, r *http.Request, p string) {
+	if r.Body != nil {
+		data, err := io.ReadAll(r.Body)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, 40000002, err.Error())
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(data))
+	}
+
+	rec := httptest.NewRecorder()
+	s.mu.Lock()
+	s.serve(rec, r, p)
+	s.mu.Unlock()
+
+	for k, v := range rec.Header() {
+		w.Header()[k] = v
+	}
+	w.WriteHeader(rec.Code)
+	w.Write(rec.Body.Bytes())
+}
+
+func (s *Server) serve(w http.ResponseWriter, r *http.Request, p string) {
+	switch r.Method {
+	case "GET":
+		s.serveGet(w, r, p)
+	case "HEAD":
+		s.serveHead(w, p)
+	case "PUT":
+		s.servePut(w, r, p)
+	case "POST":
+		s.serveMkdir(w, r, p)
+	case "DELETE":
+		s.serveDelete(w, p)
+	case "PATCH":
+		s.serveMetadata(w, r, p)
+	default:
+		writeError(w, http.StatusMethodNotAllowed, 40500001, "method not allowed")
+	}
+}
+
+func (s *Server) serveGet(w http.ResponseWriter, r *http.Request, p string) {
+	switch {
+	case r.URL.RawQuery == "usage":
+		var n int
+		for _, obj := range s.objects {
+			n += len(obj.data)
+		}
+		fmt.Fprint(w, n)
+	case r.Header.Get("X-Upyun-List-Type") == "multi":
+		s.serveListUploads(w, r)
+	case r.Header.Get("X-Upyun-Multi-Info") == "true":
+		s.serveResumeProcess(w, p)
+	case r.Header.Get("X-Upyun-Multi-Uuid") != "":
+		s.serveListParts(w, r, p)
+	case s.isDir(p) && r.Header.Get("X-Upyun-Folder") != "false":
+		s.serveList(w, r, p)
+	default:
+		obj, ok := s.objects[p]
+		if !ok {
+			writeError(w, http.StatusNotFound, 40400001, "file or directory not found")
+			return
+		}
+		writeObjectHeader(w, obj)
+		http.ServeContent(w, r, "", obj.modified, bytes.NewReader(obj.data))
+	}
+}
+
+func writeObjectHeader(w http.ResponseWriter, obj *object) {
+	for k, v := range obj.meta {
+		w.Header().Set(k, v)
+	}
+	w.Header().Set("Content-Type", obj.contentType)
+	w.Header().Set("Content-Md5", fmt.Sprintf("%x", md5.Sum(obj.data)))
+	w.Header().Set("ETag", fmt.Sprintf("\"%x\"", md5.Sum(obj.data)))
+}
+
+func (s *Server) serveList(w http.ResponseWriter, r *http.Request, dir string) {
+	names := s.children(dir)
+	if r.Header.Get("X-List-Order") == "desc" {
+		sort.Sort(sort.Reverse(sort.StringSlice(names)))
+	}
+
+	start := 0
+	if iter := r.Header.Get("X-List-Iter"); iter != "" {
+		b, err := base64.RawURLEncoding.DecodeString(iter)
+		if err == nil {
+			start, err = strconv.Atoi(string(b))
+		}
+		if err != nil || start < 0 || start > len(names) {
+			writeError(w, http.StatusBadRequest, 40000001, "invalid iter")
+			return
+		}
+	}
+	limit := defaultLimit
+	if n, err := strconv.Atoi(r.Header.Get("X-List-Limit")); err == nil && n > 0 {
+		limit = n
+	}
+	end := start + limit
+	if end > len(names) {
+		end = len(names)
+	}
+	end = start + shortPage(r, end-start)
+	iter := base64.RawURLEncoding.EncodeToString([]byte(strconv.Itoa(end)))
+	if end >= len(names) {
+		iter = listEndIter
+	}
+
+	files := []map[string]interface{}{}
+	for _, name := range names[start:end] {
+		p := path.Join(dir, name)
+		if obj, ok := s.objects[p]; ok {
+			files = append(files, map[string]interface{}{
+				"name":          name,
+				"type":          obj.contentType,
+				"length":        len(obj.data),
+				"last_modified": obj.modified.Unix(),
+			})
+		} else {
+			files = append(files, map[string]interface{}{
+				"name":          name,
+				"type":          "folder",
+				"length":        0,
+				"last_modified": s.dirs[p].Unix(),
+			})
+		}
+	}
+	writeJSON(w, map[string]interface{}{"files": files, "iter": iter})
+}
+
+func (s *Server) serveHead(w http.ResponseWriter, p string) {
+	if obj, ok := s.objects[p]; ok {
+		writeObjectHeader(w, obj)
+		w.Header().Set("x-upyun-file-type", "file")
+		w.Header().Set("x-upyun-file-size", strconv.Itoa(len(obj.data)))
+		w.Header().Set("x-upyun-file-date", strconv.FormatInt(obj.modified.Unix(), 10))
+		return
+	}
+	if t, ok := s.dirs[p]; ok {
+		w.Header().Set("x-upyun-file-type", "folder")
+		w.Header().Set("x-upyun-file-date", strconv.FormatInt(t.Unix(), 10))
+		return
+	}
+	w.WriteHeader(http.StatusNotFound)
+}
+
+func (s *Server) servePut(w http.ResponseWriter, r *http.Request, p string) {
+	if r.Header.Get("X-Upyun-Multi-Stage") != "" {
+		s.serveMultipart(w, r, p)
+		return
+	}
+	if src := r.Header.Get("X-Upyun-Move-Source"); src != "" {
+		s.serveCopy(w, p, src, true)
+		return
+	}
+	if src := r.Header.Get("X-Upyun-Copy-Source"); src != "" {
+		s.serveCopy(w, p, src, false)
+		return
+	}
+
+	if s.isDir(p) {
+		writeError(w, http.StatusConflict, 40900001, "directory exists")
+		return
+	}
+	data, err := io.ReadAll(r.Body)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, 40000002, err.Error())
+		return
+	}
+	if r.ContentLength >= 0 && int64(len(data)) != r.ContentLength {
+		writeError(w, http.StatusBadRequest, 40000003, "content length mismatch")
+		return
+	}
+	sum := fmt.Sprintf("%x", md5.Sum(data))
+	if md5 := r.Header.Get("Content-MD5"); md5 != "" && md5 != sum {
+		writeError(w, http.StatusBadRequest, 40000004, "md5 mismatch")
+		return
+	}
+
+	obj := &object{
+		data:        data,
+		contentType: r.Header.Get("Content-Type"),
+		meta:        metaHeaders(r.Header),
+		modified:    time.Now(),
+	}
+	if obj.contentType == "" {
+		obj.contentType = "application/octet-stream"
+	}
+	s.putObject(p, obj)
+	w.Header().Set("ETag", "\""+sum+"\"")
+}
+
+func metaHeaders(header http.Header) map[string]string {
+	meta := map[string]string{}
+	for k, v := range header {
+		if lk := strings.ToLower(k); strings.HasPrefix(lk, "x-upyun-meta-") {
+			meta[lk] = v[0]
+		}
+	}
+	return meta
+}
+
+func (s *Server) serveCopy(w http.ResponseWriter, p, src string, move bool) {
+	srcPath, err := url.PathUnescape(src)
+	if err != nil || !strings.HasPrefix(srcPath, "/"+s.Bucket+"/") {
+		writeError(w, http.StatusBadRequest, 40000005, "invalid source")
+		return
+	}
+	srcPath = cleanPath(strings.TrimPrefix(srcPath, "/"+s.Bucket))
+	obj, ok := s.objects[srcPath]
+	if !ok {
+		writeError(w, http.StatusNotFound, 40400001, "source not found")
+		return
+	}
+
+	cp := *obj
+	cp.data = append([]byte(nil), obj.data...)
+	cp.meta = make(map[string]string, len(obj.meta))
+	for k, v := range obj.meta {
+		cp.meta[k] = v
+	}
+	cp.modified = time.Now()
+	if move {
+		delete(s.objects, srcPath)
+	}
+	s.putObject(p, &cp)
+}
+
+func (s *Server) serveMkdir(w http.ResponseWriter, r *http.Request, p string) {
+	if r.Header.Get("folder") != "true" && r.Header.Get("x-upyun-folder") != "true" {
+		writeError(w, http.StatusBadRequest, 40000006, "need folder header")
+		return
+	}
+	if _, ok := s.objects[p]; ok {
+		writeError(w, http.StatusConflict, 40900002, "file exists")
+		return
+	}
+	now := time.Now()
+	for dir := p; dir != "/"; dir = path.Dir(dir) {
+		if _, ok := s.dirs[dir]; !ok {
+			s.dirs[dir] = now
+		}
+	}
+}
+
+func (s *Server) serveDelete(w http.ResponseWriter, p string) {
+	if _, ok := s.objects[p]; ok {
+		delete(s.objects, p)
+		return
+	}
+	if !s.isDir(p) || p == "/" {
+		writeError(w, http.StatusNotFound, 40400001, "file or directory not found")
+		return
+	}
+	if len(s.children(p)) > 0 {
+		writeError(w, http.StatusForbidden, 40300001, "directory not empty")
+		return
+	}
+	delete(s.dirs, p)
+}
+
+func (s *Server) serveMetadata(w http.ResponseWriter, r *http.Request, p string) {
+	obj, ok := s.objects[p]
+	if !ok {
+		writeError(w, http.StatusNotFound, 40400001, "file or directory not found")
+		return
+	}
+	meta := metaHeaders(r.Header)
+	switch r.URL.Query().Get("metadata") {
+	case "merge":
+		for k, v := range meta {
+			obj.meta[k] = v
+		}
+	case "replace":
+		obj.meta = meta
+	case "delete":
+		for k := range meta {
+			delete(obj.meta, k)
+		}
+	default:
+		writeError(w, http.StatusBadRequest, 40000007, "invalid metadata operation")
+	}
+}
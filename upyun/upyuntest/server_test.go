@@ -0,0 +1,545 @@
+package upyuntest
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/upyun/go-sdk/v3/upyun"
+)
+
+func newTestServer(t *testing.T) (*Server, *upyun.UpYun) {
+	srv := NewServer("bucket", "operator", "password")
+	t.Cleanup(srv.Close)
+	return srv, upyun.NewUpYun(srv.Config())
+}
+
+func TestObjects(t *testing.T) {
+	srv, up := newTestServer(t)
+
+	err := up.Put(&upyun.PutObjectConfig{
+		Path:    "/dir/a b.txt",
+		Reader:  strings.NewReader("hello"),
+		UseMD5:  true,
+		Headers: map[string]string{"X-Upyun-Meta-Foo": "bar"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b, ok := srv.Object("/dir/a b.txt"); !ok || string(b) != "hello" {
+		t.Fatalf("object = %q, %v", b, ok)
+	}
+
+	fInfo, err := up.GetInfo("/dir/a b.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fInfo.Size != 5 || fInfo.IsDir || fInfo.Meta["x-upyun-meta-foo"] != "bar" {
+		t.Fatalf("info = %+v", fInfo)
+	}
+	dInfo, err := up.GetInfo("/dir")
+	if err != nil || !dInfo.IsDir {
+		t.Fatalf("dir info = %+v, %v", dInfo, err)
+	}
+
+	buf := &bytes.Buffer{}
+	if _, err = up.Get(&upyun.GetObjectConfig{Path: "/dir/a b.txt", Writer: buf}); err != nil {
+		t.Fatal(err)
+	}
+	if buf.String() != "hello" {
+		t.Fatalf("get = %q", buf.String())
+	}
+
+	if err = up.Copy(&upyun.CopyObjectConfig{SrcPath: "/dir/a b.txt", DestPath: "/copy.txt"}); err != nil {
+		t.Fatal(err)
+	}
+	if err = up.Move(&upyun.MoveObjectConfig{SrcPath: "/copy.txt", DestPath: "/moved.txt"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := srv.Object("/copy.txt"); ok {
+		t.Fatal("moved source still exists")
+	}
+
+	err = up.ModifyMetadata(&upyun.ModifyMetadataConfig{
+		Path:    "/moved.txt",
+		Headers: map[string]string{"X-Upyun-Meta-Baz": "qux"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	fInfo, err = up.GetInfo("/moved.txt")
+	if err != nil || fInfo.Meta["x-upyun-meta-foo"] != "bar" || fInfo.Meta["x-upyun-meta-baz"] != "qux" {
+		t.Fatalf("metadata = %+v, %v", fInfo, err)
+	}
+
+	if n, err := up.Usage(); err != nil || n != 10 {
+		t.Fatalf("usage = %d, %v", n, err)
+	}
+
+	if err = up.Delete(&upyun.DeleteObjectConfig{Path: "/dir"}); err == nil {
+		t.Fatal("deleted non-empty directory")
+	}
+	if err = up.Delete(&upyun.DeleteObjectConfig{Path: "/dir/a b.txt"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = up.GetInfo("/dir/a b.txt"); !upyun.IsNotExist(err) {
+		t.Fatalf("deleted object: %v", err)
+	}
+	if err = up.Delete(&upyun.DeleteObjectConfig{Path: "/dir", Folder: true}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestList(t *testing.T) {
+	srv, up := newTestServer(t)
+	if err := up.Mkdir("/empty"); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 10; i++ {
+		srv.PutObject(fmt.Sprintf("/list/%02d", i), []byte("x"))
+	}
+	srv.PutObject("/list/sub/a", []byte("x"))
+
+	names := []string{}
+	iter := ""
+	for {
+		files, next, err := up.ListObjects(&upyun.ListObjectsConfig{Path: "/list", Iter: iter, Limit: 3})
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, f := range files {
+			names = append(names, f.Name)
+		}
+		if next == "" {
+			break
+		}
+		iter = next
+	}
+	if len(names) != 11 || names[10] != "sub" {
+		t.Fatalf("names = %v", names)
+	}
+
+	it := up.Objects("/", &upyun.ObjectsConfig{MaxListLevel: -1, Limit: 4})
+	n := 0
+	for it.Next() {
+		n++
+	}
+	// 11 files, list/sub, list and empty
+	if err := it.Err(); err != nil || n != 14 {
+		t.Fatalf("objects = %d, %v", n, err)
+	}
+}
+
+func TestResumePut(t *testing.T) {
+	srv, up := newTestServer(t)
+
+	data := make([]byte, 11*upyun.DefaultPartSize+1)
+	rand.Read(data)
+	name := filepath.Join(t.TempDir(), "big")
+	if err := os.WriteFile(name, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, concurrency := range []int{1, 4} {
+		err := up.Put(&upyun.PutObjectConfig{
+			Path:              "/big",
+			LocalPath:         name,
+			UseResumeUpload:   true,
+			ResumeConcurrency: concurrency,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if b, _ := srv.Object("/big"); !bytes.Equal(b, data) {
+			t.Fatalf("concurrency %d: content mismatch", concurrency)
+		}
+	}
+
+	init, err := up.InitMultipartUpload(&upyun.InitMultipartUploadConfig{Path: "/parts", PartSize: upyun.DefaultPartSize})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = up.UploadPart(init, &upyun.UploadPartConfig{PartID: 0, PartSize: 3, Reader: strings.NewReader("abc")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	uploads, err := up.ListMultipartUploads(&upyun.ListMultipartConfig{Prefix: "/parts"})
+	if err != nil || len(uploads.Files) != 1 || uploads.Files[0].UUID != init.UploadID {
+		t.Fatalf("uploads = %+v, %v", uploads, err)
+	}
+	parts, err := up.ListMultipartParts(init, &upyun.ListMultipartPartsConfig{})
+	if err != nil || len(parts.Parts) != 1 || parts.Parts[0].Size != 3 {
+		t.Fatalf("parts = %+v, %v", parts, err)
+	}
+	if err = up.CompleteMultipartUpload(init, nil); err != nil {
+		t.Fatal(err)
+	}
+	if b, _ := srv.Object("/parts"); string(b) != "abc" {
+		t.Fatalf("object = %q", b)
+	}
+}
+
+// partCounter counts the parts uploaded through it.
+type partCounter struct {
+	mu    sync.Mutex
+	parts int
+}
+
+func (c *partCounter) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Header.Get("X-Upyun-Multi-Stage") == "upload" {
+		c.mu.Lock()
+		c.parts++
+		c.mu.Unlock()
+	}
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+func TestResumeReconcile(t *testing.T) {
+	srv, up := newTestServer(t)
+	counter := &partCounter{}
+	up.SetHTTPClient(&http.Client{Transport: counter})
+
+	data := make([]byte, 11*upyun.DefaultPartSize+1)
+	rand.Read(data)
+	name := filepath.Join(t.TempDir(), "big")
+	if err := os.WriteFile(name, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	partSize := int64(2 * upyun.DefaultPartSize)
+	sendParts := func(path string) {
+		init, err := up.InitMultipartUpload(&upyun.InitMultipartUploadConfig{
+			Path:          path,
+			PartSize:      partSize,
+			ContentLength: int64(len(data)),
+			OrderUpload:   true,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		// all but the last, shorter part
+		for id := 0; id < 5; id++ {
+			err = up.UploadPart(init, &upyun.UploadPartConfig{
+				PartID:   id,
+				PartSize: partSize,
+				Reader:   bytes.NewReader(data[int64(id)*partSize : int64(id+1)*partSize]),
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	put := func(path string) {
+		counter.parts = 0
+		err := up.Put(&upyun.PutObjectConfig{Path: path, LocalPath: name, UseResumeUpload: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if b, _ := srv.Object(path); !bytes.Equal(b, data) {
+			t.Fatalf("%s: content mismatch", path)
+		}
+		if counter.parts != 1 {
+			t.Fatalf("%s: %d parts sent again", path, counter.parts-1)
+		}
+	}
+
+	// reported by GetResumeProcess, with the size of the last part
+	sendParts("/process")
+	put("/process")
+
+	// listed on the second page of ListMultipartUploads, behind a later
+	// upload of other content
+	for i := 0; i < defaultLimit; i++ {
+		if _, err := up.InitMultipartUpload(&upyun.InitMultipartUploadConfig{
+			Path:     fmt.Sprintf("/listed-%d", i),
+			PartSize: upyun.DefaultPartSize,
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	sendParts("/listed")
+	if _, err := up.InitMultipartUpload(&upyun.InitMultipartUploadConfig{
+		Path:          "/listed",
+		PartSize:      upyun.DefaultPartSize,
+		ContentLength: 1,
+		OrderUpload:   true,
+	}); err != nil {
+		t.Fatal(err)
+	}
+	put("/listed")
+}
+
+func TestListMultipartUploads(t *testing.T) {
+	_, up := newTestServer(t)
+
+	for i := 0; i < 3; i++ {
+		_, err := up.InitMultipartUpload(&upyun.InitMultipartUploadConfig{
+			Path:     fmt.Sprintf("/uploads/%d", i),
+			PartSize: upyun.DefaultPartSize,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	var keys []string
+	config := &upyun.ListMultipartConfig{Prefix: "/uploads", Limit: 2}
+	for pages := 1; ; pages++ {
+		uploads, err := up.ListMultipartUploads(config)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, file := range uploads.Files {
+			keys = append(keys, file.Key)
+		}
+		if uploads.Iter == listEndIter {
+			if pages != 2 {
+				t.Fatalf("pages = %d", pages)
+			}
+			break
+		}
+		config.Iter = uploads.Iter
+	}
+	if strings.Join(keys, ",") != "/uploads/0,/uploads/1,/uploads/2" {
+		t.Fatalf("keys = %v", keys)
+	}
+}
+
+func TestCleanMultipartUploads(t *testing.T) {
+	srv, up := newTestServer(t)
+	data := make([]byte, upyun.DefaultPartSize)
+	uploads := map[string]int{"/stale/whole": 2, "/stale/partial": 1}
+	for p, n := range uploads {
+		result, err := up.InitMultipartUpload(&upyun.InitMultipartUploadConfig{
+			Path:          p,
+			PartSize:      upyun.DefaultPartSize,
+			ContentLength: 2 * upyun.DefaultPartSize,
+			OrderUpload:   true,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		for id := 0; id < n; id++ {
+			err = up.UploadPart(result, &upyun.UploadPartConfig{
+				PartID:   id,
+				PartSize: upyun.DefaultPartSize,
+				Reader:   bytes.NewReader(data),
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	stale, err := up.CleanMultipartUploads(&upyun.CleanMultipartConfig{
+		Prefix:   "/stale",
+		MaxAge:   time.Nanosecond,
+		Finalize: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(stale) != len(uploads) {
+		t.Fatalf("stale = %v", stale)
+	}
+	for _, u := range stale {
+		whole := u.Path == "/stale/whole"
+		if u.Err != nil || u.Whole != whole || u.Finalized != whole {
+			t.Errorf("%s: whole = %v, finalized = %v, err = %v", u.Path, u.Whole, u.Finalized, u.Err)
+		}
+	}
+	if _, ok := srv.Object("/stale/whole"); !ok {
+		t.Error("whole upload not finalized")
+	}
+	if _, ok := srv.Object("/stale/partial"); ok {
+		t.Error("partial upload finalized")
+	}
+}
+
+func TestWriterAbort(t *testing.T) {
+	srv, up := newTestServer(t)
+	data := make([]byte, 2*upyun.DefaultPartSize+1)
+	rand.Read(data)
+
+	w, err := up.NewWriter("/aborted", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = w.Write(data); err != nil {
+		t.Fatal(err)
+	}
+	abort := errors.New("abort")
+	if err = w.CloseWithError(abort); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = w.Write(data); err != abort {
+		t.Fatalf("write after abort: %v", err)
+	}
+	if err = w.Close(); err != abort {
+		t.Fatalf("close after abort: %v", err)
+	}
+	if _, ok := srv.Object("/aborted"); ok {
+		t.Fatal("aborted upload committed")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	w, err = up.NewWriterContext(ctx, "/canceled", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = w.Write(data); err != nil {
+		t.Fatal(err)
+	}
+	cancel()
+	if err = w.Close(); !errors.Is(err, context.Canceled) {
+		t.Fatalf("close after cancel: %v", err)
+	}
+	if _, ok := srv.Object("/canceled"); ok {
+		t.Fatal("canceled upload committed")
+	}
+}
+
+func TestSyncTwice(t *testing.T) {
+	_, up := newTestServer(t)
+	dir := t.TempDir()
+	// modified late in the second of the upload, which the remote time
+	// drops
+	mtime := time.Now().Truncate(time.Second).Add(999 * time.Millisecond)
+	for _, name := range []string{"a", "b", "c"} {
+		p := filepath.Join(dir, name)
+		if err := os.WriteFile(p, []byte(name), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(p, mtime, mtime); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	config := &upyun.SyncConfig{LocalDir: dir, RemoteDir: "/sync"}
+	report, err := up.Sync(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Count[upyun.SyncUpload] != 3 {
+		t.Fatalf("first sync: %s", report)
+	}
+	report, err = up.Sync(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Items) != 0 || report.Skipped != 3 {
+		t.Fatalf("second sync: %s", report)
+	}
+}
+
+func TestSyncModified(t *testing.T) {
+	srv, up := newTestServer(t)
+	dir := t.TempDir()
+	mtime := time.Now().Truncate(time.Second)
+	write := func(name string, data []byte, mtime time.Time) {
+		p := filepath.Join(dir, name)
+		if err := os.WriteFile(p, data, 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(p, mtime, mtime); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// big is sent by a multipart upload
+	big := make([]byte, 10*upyun.DefaultPartSize)
+	write("small", []byte("a"), mtime)
+	write("big", big, mtime)
+
+	config := &upyun.SyncConfig{LocalDir: dir, RemoteDir: "/sync"}
+	if _, err := up.Sync(config); err != nil {
+		t.Fatal(err)
+	}
+	for _, test := range []struct {
+		name  string
+		data  []byte
+		mtime time.Time
+	}{
+		// changed within the second of the upload
+		{"small", []byte("b"), mtime.Add(time.Millisecond)},
+		// restored from a backup, older than the upload
+		{"small", []byte("c"), mtime.Add(-time.Hour)},
+		{"big", append([]byte("b"), big[1:]...), mtime.Add(-time.Hour)},
+	} {
+		write(test.name, test.data, test.mtime)
+		report, err := up.Sync(config)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if report.Count[upyun.SyncOverwrite] != 1 {
+			t.Fatalf("%s modified at %s: %s", test.name, test.mtime, report)
+		}
+		obj, _ := srv.Object("/sync/" + test.name)
+		if !bytes.Equal(obj, test.data) {
+			t.Fatalf("%s not overwritten", test.name)
+		}
+	}
+
+	report, err := up.Sync(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Items) != 0 || report.Skipped != 2 {
+		t.Fatalf("unchanged sync: %s", report)
+	}
+}
+
+func TestConcurrentRequests(t *testing.T) {
+	srv, up := newTestServer(t)
+	srv.PutObject("/small", []byte("x"))
+
+	// an upload whose body is still being sent does not block the others
+	pr, pw := io.Pipe()
+	done := make(chan error, 1)
+	go func() {
+		done <- up.Put(&upyun.PutObjectConfig{
+			Path:    "/slow",
+			Reader:  pr,
+			Headers: map[string]string{"Content-Length": "2"},
+		})
+	}()
+	pw.Write([]byte("a"))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if _, err := up.GetInfoContext(ctx, "/small"); err != nil {
+		pw.CloseWithError(err)
+		t.Fatal(err)
+	}
+	pw.Write([]byte("b"))
+	pw.Close()
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	if b, _ := srv.Object("/slow"); string(b) != "ab" {
+		t.Fatalf("object = %q", b)
+	}
+}
+
+func TestAuth(t *testing.T) {
+	srv, _ := newTestServer(t)
+	config := srv.Config()
+	config.Password = "wrong"
+	_, err := upyun.NewUpYun(config).GetInfo("/")
+	if e, ok := err.(*upyun.Error); !ok || e.StatusCode != 401 {
+		t.Fatalf("err = %v", err)
+	}
+
+	up := upyun.NewUpYun(srv.Config())
+	up.UseDeprecatedApi()
+	if err = up.Put(&upyun.PutObjectConfig{Path: "/a", Reader: strings.NewReader("a")}); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -1,6 +1,7 @@
 package upyun
 
 import (
+	"context"
 	"crypto/hmac"
 	"crypto/md5"
 	"crypto/sha1"
@@ -233,8 +234,25 @@ func parseBodyToFileInfos(b []byte) (iter string, fInfos []*FileInfo, err error)
 	return
 }
 
-func isRecordExpired(fileinfo os.FileInfo, breakpoint *BreakPointConfig) bool {
-	return fileinfo.ModTime() != breakpoint.FileModTime ||
-		breakpoint.LastTime.Add(24*time.Hour).Before(time.Now()) ||
+func isRecordExpired(fileinfo os.FileInfo, breakpoint *BreakPointConfig, fingerprint string, ttl time.Duration) bool {
+	// nothing tells whether the content has changed
+	if fileinfo.ModTime().IsZero() && fingerprint == "" {
+		return true
+	}
+	return !fileinfo.ModTime().Equal(breakpoint.FileModTime) ||
+		breakpoint.Fingerprint != fingerprint ||
+		breakpoint.LastTime.Add(ttl).Before(time.Now()) ||
 		breakpoint.FileSize != fileinfo.Size()
 }
+
+// sleepContext waits for d or until ctx is done, whichever happens first.
+func sleepContext(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
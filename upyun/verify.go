@@ -0,0 +1,139 @@
+package upyun
+
+import (
+	"bytes"
+	"crypto/subtle"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const maxPurgeBodySize = 1 << 20
+
+// Verifier checks the signature of requests made to a service accepting
+// UpYun credentials: the unified scheme of MakeUnifiedAuth, the REST scheme
+// of MakeRESTAuth and the purge scheme of MakePurgeAuth.
+type Verifier struct {
+	// MaxSkew: requests dated further from now are rejected, default 30
+	// minutes as UpYun does
+	MaxSkew time.Duration
+	// Password returns the password of an operator, false if unknown
+	Password func(operator string) (string, bool)
+}
+
+// NewVerifier returns a Verifier of the operators of passwords.
+func NewVerifier(passwords map[string]string) *Verifier {
+	return &Verifier{
+		Password: func(operator string) (string, bool) {
+			password, ok := passwords[operator]
+			return password, ok
+		},
+	}
+}
+
+// Verify returns the operator which signed r. The signed URI is the request
+// URI of r, the body is only read for purge requests, and is then put back.
+// The Content-MD5 header is signed but not checked against the body.
+func (v *Verifier) Verify(r *http.Request) (operator string, err error) {
+	auth := r.Header.Get("Authorization")
+	date := r.Header.Get("Date")
+	if auth == "" || date == "" {
+		return "", errorOperation("verify: need authorization and date", nil)
+	}
+	t, err := http.ParseTime(date)
+	if err != nil {
+		return "", errorOperation("verify: invalid date", nil)
+	}
+	maxSkew := v.MaxSkew
+	if maxSkew <= 0 {
+		maxSkew = serverDateSkew
+	}
+	if skew := time.Since(t); skew > maxSkew || skew < -maxSkew {
+		return "", errorOperation("verify: date offset error", nil)
+	}
+
+	if !strings.HasPrefix(auth, "UpYun ") {
+		return "", errorOperation("verify: invalid authorization", nil)
+	}
+	fields := strings.Split(strings.TrimPrefix(auth, "UpYun "), ":")
+	var bucket string
+	switch len(fields) {
+	case 2:
+		operator = fields[0]
+	case 3:
+		bucket, operator = fields[0], fields[1]
+	default:
+		return "", errorOperation("verify: invalid authorization", nil)
+	}
+	password, ok := v.Password(operator)
+	if !ok {
+		return "", errorOperation("verify: unknown operator", nil)
+	}
+	keys := &signKeys{operator: operator, password: md5Str(password)}
+
+	var expect []string
+	if bucket != "" {
+		purgeList, err := readPurgeList(r)
+		if err != nil {
+			return "", errorOperation("verify", err)
+		}
+		expect = append(expect, makePurgeAuth(keys, bucket, &PurgeAuthConfig{
+			PurgeList: purgeList,
+			DateStr:   date,
+		}))
+	} else {
+		uri := r.RequestURI
+		if uri == "" {
+			uri = r.URL.RequestURI()
+		}
+		length := ""
+		if r.ContentLength >= 0 {
+			length = strconv.FormatInt(r.ContentLength, 10)
+		}
+		expect = append(expect,
+			makeUnifiedAuth(keys, &UnifiedAuthConfig{
+				Method:     r.Method,
+				Uri:        uri,
+				DateStr:    date,
+				ContentMD5: r.Header.Get("Content-MD5"),
+			}),
+			makeRESTAuth(keys, &RESTAuthConfig{
+				Method:    r.Method,
+				Uri:       uri,
+				DateStr:   date,
+				LengthStr: length,
+			}),
+		)
+	}
+	for _, e := range expect {
+		if subtle.ConstantTimeCompare([]byte(e), []byte(auth)) == 1 {
+			return operator, nil
+		}
+	}
+	return "", errorOperation("verify: sign error", nil)
+}
+
+// readPurgeList returns the purge field of the form body of r, and puts the
+// body back. Bodies over maxPurgeBodySize are rejected rather than truncated.
+func readPurgeList(r *http.Request) (string, error) {
+	if r.Body == nil {
+		return "", nil
+	}
+	b, err := io.ReadAll(io.LimitReader(r.Body, maxPurgeBodySize+1))
+	r.Body.Close()
+	if err != nil {
+		return "", err
+	}
+	if len(b) > maxPurgeBodySize {
+		return "", errorOperation("purge body too large", nil)
+	}
+	r.Body = io.NopCloser(bytes.NewReader(b))
+	values, err := url.ParseQuery(string(b))
+	if err != nil {
+		return "", err
+	}
+	return values.Get("purge"), nil
+}
@@ -0,0 +1,76 @@
+package upyun
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestVerifier(t *testing.T) {
+	verifier := NewVerifier(map[string]string{"operator": "password"})
+	signer := NewUpYun(&UpYunConfig{Bucket: "bucket", Operator: "operator", Password: "password"})
+
+	// unified
+	req := httptest.NewRequest("PUT", "/bucket/a%20b.txt?x=1", strings.NewReader("hello"))
+	Nil(t, signer.SignRequest(req))
+	operator, err := verifier.Verify(req)
+	Nil(t, err)
+	Equal(t, operator, "operator")
+	req.Header.Set("Content-MD5", md5Str("olleh"))
+	_, err = verifier.Verify(req)
+	NotNil(t, err)
+
+	// rest
+	signer.UseDeprecatedApi()
+	req = httptest.NewRequest("GET", "/bucket/a", nil)
+	Nil(t, signer.SignRequest(req))
+	operator, err = verifier.Verify(req)
+	Nil(t, err)
+	Equal(t, operator, "operator")
+
+	// purge
+	date := makeRFC1123Date(time.Now())
+	purgeList := "http://example.com/a\nhttp://example.com/b"
+	body := url.Values{"purge": {purgeList}}.Encode()
+	req = httptest.NewRequest("POST", "/purge/", strings.NewReader(body))
+	req.Header.Set("Date", date)
+	req.Header.Set("Authorization", signer.MakePurgeAuth(&PurgeAuthConfig{PurgeList: purgeList, DateStr: date}))
+	operator, err = verifier.Verify(req)
+	Nil(t, err)
+	Equal(t, operator, "operator")
+	b, _ := io.ReadAll(req.Body)
+	Equal(t, string(b), body)
+
+	// oversize purge body
+	body = url.Values{"purge": {purgeList}, "zpad": {strings.Repeat("x", maxPurgeBodySize)}}.Encode()
+	req = httptest.NewRequest("POST", "/purge/", strings.NewReader(body))
+	req.Header.Set("Date", date)
+	req.Header.Set("Authorization", signer.MakePurgeAuth(&PurgeAuthConfig{PurgeList: purgeList, DateStr: date}))
+	_, err = verifier.Verify(req)
+	NotNil(t, err)
+
+	// date skew, unknown operator and wrong password
+	req = httptest.NewRequest("GET", "/bucket/a", nil)
+	date = makeRFC1123Date(time.Now().Add(-time.Hour))
+	req.Header.Set("Date", date)
+	req.Header.Set("Authorization", signer.MakeRESTAuth(&RESTAuthConfig{Method: "GET", Uri: "/bucket/a", DateStr: date, LengthStr: "0"}))
+	_, err = verifier.Verify(req)
+	NotNil(t, err)
+	verifier.MaxSkew = 2 * time.Hour
+	_, err = verifier.Verify(req)
+	Nil(t, err)
+
+	for _, other := range []*UpYun{
+		NewUpYun(&UpYunConfig{Bucket: "bucket", Operator: "other", Password: "password"}),
+		NewUpYun(&UpYunConfig{Bucket: "bucket", Operator: "operator", Password: "wrong"}),
+	} {
+		req, _ = http.NewRequest("GET", "http://v0.api.upyun.com/bucket/a", nil)
+		Nil(t, other.SignRequest(req))
+		_, err = verifier.Verify(req)
+		NotNil(t, err)
+	}
+}
@@ -0,0 +1,197 @@
+package upyun
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"strconv"
+)
+
+// WriterConfig provides a configuration to NewWriter.
+type WriterConfig struct {
+	// PartSize: size of the buffered parts, a multiple of DefaultPartSize
+	PartSize    int64
+	ContentType string
+	// UseMD5: verify the md5 of the whole content when committing
+	UseMD5 bool
+}
+
+// UploadWriter uploads everything written to it, see NewWriter.
+type UploadWriter struct {
+	up     *UpYun
+	ctx    context.Context
+	path   string
+	config WriterConfig
+
+	buf        []byte
+	initResult *InitMultipartUploadResult
+	partID     int
+	hash       hash.Hash
+	err        error
+	closed     bool
+}
+
+// NewWriter returns a writer uploading everything written to it to path.
+// Data is buffered into parts of config.PartSize and sent as a multipart
+// upload, which is only committed by Close. After an error, or CloseWithError,
+// the upload is abandoned and never committed.
+func (up *UpYun) NewWriter(path string, config *WriterConfig) (*UploadWriter, error) {
+	return up.NewWriterContext(context.Background(), path, config)
+}
+
+// NewWriterContext is NewWriter with a context, cancelling ctx aborts the
+// upload: Write and Close then fail and nothing is committed.
+func (up *UpYun) NewWriterContext(ctx context.Context, path string, config *WriterConfig) (*UploadWriter, error) {
+	w := &UploadWriter{
+		up:   up,
+		ctx:  ctx,
+		path: path,
+	}
+	if config != nil {
+		w.config = *config
+	}
+	partSize, _, err := getPartInfo(w.config.PartSize, 0)
+	if err != nil {
+		return nil, errorOperation("new writer", err)
+	}
+	w.config.PartSize = partSize
+	w.buf = make([]byte, 0, partSize)
+	if w.config.UseMD5 {
+		w.hash = md5.New()
+	}
+	return w, nil
+}
+
+func (w *UploadWriter) Write(p []byte) (n int, err error) {
+	if w.err != nil {
+		return 0, w.err
+	}
+	if w.closed {
+		return 0, errors.New("write on closed writer")
+	}
+
+	for len(p) > 0 {
+		// a full part is only sent once more data shows up, so that
+		// small contents end up in a single put on Close
+		if int64(len(w.buf)) == w.config.PartSize {
+			if err = w.uploadPart(); err != nil {
+				w.err = err
+				return n, err
+			}
+		}
+		m := int(w.config.PartSize) - len(w.buf)
+		if m > len(p) {
+			m = len(p)
+		}
+		w.buf = append(w.buf, p[:m]...)
+		if w.hash != nil {
+			w.hash.Write(p[:m])
+		}
+		n += m
+		p = p[m:]
+	}
+	return n, nil
+}
+
+func (w *UploadWriter) uploadPart() error {
+	if w.partID >= MaxPartNum {
+		return fmt.Errorf("The maximum part number is  %d", MaxPartNum)
+	}
+	if w.initResult == nil {
+		initResult, err := w.up.InitMultipartUploadContext(w.ctx, &InitMultipartUploadConfig{
+			Path:        w.path,
+			PartSize:    w.config.PartSize,
+			ContentType: w.config.ContentType,
+			OrderUpload: true,
+		})
+		if err != nil {
+			return err
+		}
+		w.initResult = initResult
+	}
+
+	err := w.up.UploadPartContext(w.ctx, w.initResult, &UploadPartConfig{
+		PartID:   w.partID,
+		PartSize: int64(len(w.buf)),
+		Reader:   bytes.NewReader(w.buf),
+	})
+	if err != nil {
+		return err
+	}
+	w.partID++
+	w.buf = w.buf[:0]
+	return nil
+}
+
+// Close uploads the buffered data and commits the upload.
+func (w *UploadWriter) Close() error {
+	if w.closed {
+		return w.err
+	}
+	w.closed = true
+	if w.err != nil {
+		return w.err
+	}
+	if w.err = w.ctx.Err(); w.err != nil {
+		return w.err
+	}
+
+	var md5Sum string
+	if w.hash != nil {
+		md5Sum = fmt.Sprintf("%x", w.hash.Sum(nil))
+	}
+
+	if w.initResult == nil {
+		headers := map[string]string{
+			"Content-Length": strconv.Itoa(len(w.buf)),
+		}
+		if w.config.ContentType != "" {
+			headers["Content-Type"] = w.config.ContentType
+		}
+		if md5Sum != "" {
+			headers["Content-MD5"] = md5Sum
+		}
+		w.err = w.up.put(w.ctx, &PutObjectConfig{
+			Path:    w.path,
+			Reader:  bytes.NewReader(w.buf),
+			Headers: headers,
+		})
+		return w.err
+	}
+
+	if len(w.buf) > 0 {
+		if w.err = w.uploadPart(); w.err != nil {
+			return w.err
+		}
+	}
+	w.err = w.up.CompleteMultipartUploadContext(w.ctx, w.initResult, &CompleteMultipartUploadConfig{
+		Md5: md5Sum,
+	})
+	return w.err
+}
+
+// CloseWithError abandons the upload without committing it, as
+// io.PipeWriter does: later writes return err, io.ErrClosedPipe if nil.
+// It always returns nil.
+//
+// The parts already sent are not cleaned up: the REST API cannot abort a
+// multipart upload, so they stay on the server until it expires the upload.
+// CleanMultipartUploads reports such uploads but never completes them, as
+// they are partial.
+func (w *UploadWriter) CloseWithError(err error) error {
+	if w.closed {
+		return nil
+	}
+	w.closed = true
+	if err == nil {
+		err = io.ErrClosedPipe
+	}
+	if w.err == nil {
+		w.err = err
+	}
+	return nil
+}
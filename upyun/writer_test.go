@@ -0,0 +1,29 @@
+package upyun
+
+import (
+	"bytes"
+	"io"
+	"path"
+	"testing"
+)
+
+func TestWriter(t *testing.T) {
+	for _, size := range []int{0, 1024, 3*DefaultPartSize + 1024} {
+		data := bytes.Repeat([]byte("U"), size)
+		key := path.Join(ROOT, "WRITER", "FILE")
+
+		w, err := up.NewWriter(key, &WriterConfig{UseMD5: true})
+		Nil(t, err)
+		_, err = io.Copy(w, bytes.NewReader(data))
+		Nil(t, err)
+		Nil(t, w.Close())
+
+		fInfo, err := up.GetInfo(key)
+		Nil(t, err)
+		Equal(t, fInfo.Size, int64(size))
+		Equal(t, fInfo.MD5, md5Str(string(data)))
+
+		err = up.Delete(&DeleteObjectConfig{Path: key})
+		Nil(t, err)
+	}
+}